@@ -2,7 +2,7 @@ package fineline
 
 import (
 	"fmt"
-	"strings"
+	"os/signal"
 	"syscall"
 )
 
@@ -13,8 +13,11 @@ type LineReader struct {
 }
 
 // enable raw mode and gather metrics, like number of columns
-func (l *LineReader) raw() {
-	tcgetattr(0, &l.origTerm)
+func (l *LineReader) raw() error {
+	if err := tcgetattr(l.fd, &l.origTerm); err != nil {
+		// most likely not a terminal
+		return err
+	}
 
 	// Modify the original mode
 	raw := l.origTerm
@@ -30,41 +33,60 @@ func (l *LineReader) raw() {
 	raw.Cc[VMIN] = 1
 	raw.Cc[VTIME] = 0
 
-	tcsetattr(0, TCSAFLUSH, &raw)
+	if err := tcsetattr(l.fd, TCSAFLUSH, &raw); err != nil {
+		return err
+	}
 
-	var win winsize
-	winIoctl(1, syscall.TIOCGWINSZ, &win)
-	l.cols = int(win.Col)
+	l.cols, l.rows = l.termSize()
+	// readRune hears about resizes until restore
+	signal.Notify(l.winch, syscall.SIGWINCH)
+	return nil
 }
 
 func (l *LineReader) restore() {
-	tcsetattr(0, TCSAFLUSH, &l.origTerm)
+	signal.Stop(l.winch)
+	tcsetattr(l.fd, TCSAFLUSH, &l.origTerm)
+}
+
+// returns the number of columns and rows the terminal has
+func (l *LineReader) termSize() (cols, rows int) {
+	var win winsize
+	winIoctl(l.fd, syscall.TIOCGWINSZ, &win)
+	cols, rows = int(win.Col), int(win.Row)
+	if cols == 0 {
+		cols = 80
+	}
+	if rows == 0 {
+		rows = 24
+	}
+	return cols, rows
+}
+
+// the terminal's been resized, so draw the line again to fit
+func (l *LineReader) resize() {
+	cols, rows := l.termSize()
+	l.rows = rows
+	l.reflow(cols)
 }
 
 // x is absolute, y is relative
 func (l *LineReader) setCursor(x, y int) {
-	fmt.Printf("\x1b[%dG", x + 1)
+	fmt.Fprintf(l.output, "\x1b[%dG", x + 1)
 	// positive is down, negative is up
 	if y > 0 {
-		fmt.Printf("\x1b[%dB", y)
+		fmt.Fprintf(l.output, "\x1b[%dB", y)
 	} else if y < 0 {
-		fmt.Printf("\x1b[%dA", -y)
+		fmt.Fprintf(l.output, "\x1b[%dA", -y)
 	}
 }
 
 // erase everything from the cursor to the end of the screen
 func (l *LineReader) eraseToEnd() {
 	// erase to right
-	fmt.Print("\x1b[0J")
-}
-
-func (l *LineReader) printCandidates() {
-	str := "\n\x1b[0G" + strings.Join(l.candidates, "\n\x1b[0G") + "\n"
-	fmt.Print(str)
-	l.refreshLine()
+	fmt.Fprint(l.output, "\x1b[0J")
 }
 
 func (l *LineReader) clearScreen() {
 	// move to upper left corner, then clear entire screen
-	fmt.Print("\x1b[H\x1b[2J")
+	fmt.Fprint(l.output, "\x1b[H\x1b[2J")
 }
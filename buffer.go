@@ -30,14 +30,16 @@ func (b *buffer) len() int {
 	return len(b.buf)
 }
 
-func (b *buffer) remove(pos int) {
-	if pos >= len(b.buf) {
-		return
+// remove the bytes from start up to end
+func (b *buffer) remove(start, end int) {
+	if end > len(b.buf) {
+		end = len(b.buf)
 	}
-	if pos < len(b.buf) {
-		copy(b.buf[pos:], b.buf[pos+1:])
+	if start >= end {
+		return
 	}
-	b.buf = b.buf[:len(b.buf)-1]
+	copy(b.buf[start:], b.buf[end:])
+	b.buf = b.buf[:len(b.buf)-(end-start)]
 }
 
 func (b *buffer) reset() {
@@ -54,14 +56,12 @@ func (b *buffer) truncate(pos int) {
 	b.buf = b.buf[:pos]
 }
 
-func (b *buffer) transpose(pos int) {
-	if pos == 0 {
-		return
-	}
-	if pos == len(b.buf) {
-		pos--
-	}
-	b.buf[pos-1], b.buf[pos] = b.buf[pos], b.buf[pos-1]
+// swap the bytes from start to mid with the ones from mid to end
+func (b *buffer) swap(start, mid, end int) {
+	tmp := make([]byte, mid-start)
+	copy(tmp, b.buf[start:mid])
+	copy(b.buf[start:], b.buf[mid:end])
+	copy(b.buf[start+end-mid:], tmp)
 }
 
 func (b *buffer) Write(p []byte, pos int) {
@@ -15,6 +15,100 @@ type Completer interface {
 	Complete(str string) []string
 }
 
+// A Candidate is a possible completion: Replacement takes the place of the
+// bytes from Start to End of the line, which is usually the word the cursor's
+// in or at the end of.
+type Candidate struct {
+	// what's shown in the list of candidates; Replacement if it's empty
+	Display string
+	// the text put into the line
+	Replacement string
+	// an optional note shown beside Display in the list
+	Description string
+	// the byte range of the line being completed that's replaced
+	Start, End int
+}
+
+// A CandidateCompleter provides candidates for tab-completion, saying exactly
+// what each one replaces.
+type CandidateCompleter interface {
+	// Candidates takes the line, split at the cursor, and returns the
+	// candidates for completing it. Their ranges are of before+after.
+	Candidates(before, after string) []Candidate
+}
+
+// CandidateCompleterFunc lets an ordinary function be used as a
+// CandidateCompleter.
+type CandidateCompleterFunc func(before, after string) []Candidate
+
+func (f CandidateCompleterFunc) Candidates(before, after string) []Candidate {
+	return f(before, after)
+}
+
+// AdaptCompleter makes a CandidateCompleter out of c. c is given the line up
+// to the cursor, and each string it returns replaces as much of the end of
+// that as it starts with, along with the rest of the word after the cursor.
+// So with the cursor after "ca" in "cax", "cat" completes it to "cat" and
+// "/usr/" to "ca/usr/". If c is a CandidateCompleter already, it's returned
+// as it is.
+func AdaptCompleter(c Completer) CandidateCompleter {
+	if cc, ok := c.(CandidateCompleter); ok {
+		return cc
+	}
+	return completerAdapter{c}
+}
+
+// SetCompleter makes l use c for tab completion, in place of the Completer
+// it was created with. If c is nil, tab is just inserted.
+func (l *LineReader) SetCompleter(c CandidateCompleter) {
+	l.c = c
+}
+
+// returns what's shown for c in the list of candidates
+func (c Candidate) display() string {
+	if c.Display == "" {
+		return c.Replacement
+	}
+	return c.Display
+}
+
+type completerAdapter struct {
+	c Completer
+}
+
+func (a completerAdapter) Candidates(before, after string) []Candidate {
+	// the rest of the word goes too
+	end := len(before) + len(after)
+	if i := strings.IndexAny(after, " \t\n"); i >= 0 {
+		end = len(before) + i
+	}
+	var candidates []Candidate
+	for _, s := range a.c.Complete(before) {
+		n := overlap(before, s)
+		candidates = append(candidates, Candidate{
+			Display:     s,
+			Replacement: s,
+			Start:       len(before) - n,
+			End:         end,
+		})
+	}
+	return candidates
+}
+
+// returns the length of the longest end of head that tail starts with
+func overlap(head, tail string) int {
+	n := len(tail)
+	if len(head) < n {
+		n = len(head)
+	}
+	for ; n > 0; n-- {
+		if strings.HasSuffix(head, tail[:n]) {
+			break
+		}
+	}
+	return n
+}
+
 // A SimpleCompleter provides completion candidates from a list
 // of strings. Words are separated by Delim, which is a single
 // space by default.
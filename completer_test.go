@@ -1,6 +1,7 @@
 package fineline
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -51,3 +52,129 @@ func TestSimpleCompleter(t *testing.T) {
 		}
 	}
 }
+
+func TestAdaptCompleter(t *testing.T) {
+	c := AdaptCompleter(NewSimpleCompleter([]string{"cat", "dog"}))
+	for _, test := range []struct {
+		before, after string
+		expected      Candidate
+	}{
+		{"dog ca", "", Candidate{Display: "cat", Replacement: "cat", Start: 4, End: 6}},
+		{"dog c ", "", Candidate{Display: "cat", Replacement: "cat", Start: 6, End: 6}},
+		{"dog ca", "tch dog", Candidate{Display: "cat", Replacement: "cat", Start: 4, End: 9}},
+	} {
+		candidates := c.Candidates(test.before, test.after)
+		if len(candidates) == 0 || candidates[0] != test.expected {
+			t.Errorf("%q, %q: expected %+v first, got %+v", test.before, test.after, test.expected, candidates)
+		}
+	}
+}
+
+// completes ~ to a home directory, with the users' names as descriptions
+var homes = CandidateCompleterFunc(func(before, after string) []Candidate {
+	i := strings.LastIndex(before, "~")
+	if i < 0 {
+		return nil
+	}
+	end := len(before) + len(after)
+	if j := strings.IndexByte(after, ' '); j >= 0 {
+		end = len(before) + j
+	}
+	var candidates []Candidate
+	for _, user := range []struct{ login, name string }{
+		{"alice", "Alice"},
+		{"alan", "Alan"},
+		{"bob", "Bob"},
+	} {
+		if strings.HasPrefix(user.login, before[i+1:]) {
+			candidates = append(candidates, Candidate{
+				Display:     "~" + user.login,
+				Replacement: "/home/" + user.login + "/",
+				Description: user.name,
+				Start:       i,
+				End:         end,
+			})
+		}
+	}
+	return candidates
+})
+
+func TestComplete(t *testing.T) {
+	for _, test := range []struct {
+		input, expected string
+	}{
+		{"cd ~b\t", "cd /home/bob/"},
+		{"cd ~al\t", "cd ~al"},
+		{"cd ~c\t", "cd ~c"},
+		{"cd ~bo\tx", "cd /home/bob/x"},
+		// only the word the cursor's in is replaced
+		{"cd ~bxx y\x02\x02\x02\x02\t", "cd /home/bob/ y"},
+		{"cd ~bxx y\x02\x02\x02\x02\tz", "cd /home/bob/z y"},
+	} {
+		l, _ := newTestReader(test.input)
+		l.SetCompleter(homes)
+		l.getLine()
+		if line, _ := l.Buffer(); line != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, line)
+		}
+	}
+}
+
+func TestCompleteCommonPrefix(t *testing.T) {
+	l, out := newTestReader("cd ~\t\t")
+	l.SetCompleter(CandidateCompleterFunc(func(before, after string) []Candidate {
+		candidates := homes(before, after)
+		// ~alice/ and ~alan/ share ~al
+		for i := range candidates {
+			candidates[i].Replacement = "~" + candidates[i].Replacement[len("/home/"):]
+		}
+		return candidates[:2]
+	}))
+	l.getLine()
+	if line, _ := l.Buffer(); line != "cd ~al" {
+		t.Errorf("expected %q, got %q", "cd ~al", line)
+	}
+	if !strings.Contains(out.String(), "\r\n~alice  Alice  ~alan   Alan\r\n") {
+		t.Errorf("expected the candidates listed with descriptions, got %q", out.String())
+	}
+}
+
+func TestCompleteMidLine(t *testing.T) {
+	for _, test := range []struct {
+		input, expected string
+	}{
+		{"cou dog\x01\x06\x06\t", "cough dog"},
+		{"cau dog\x01\x06\x06\x06\t", "caught dog"},
+		// more than one candidate only fills in what they share
+		{"cax dog\x01\x06\x06\t", "cax dog"},
+		{"cux dog\x01\x06\x06\t", "cux dog"},
+		{"dog caug\x02\t!", "dog caught!"},
+	} {
+		l, _ := newTestReader(test.input)
+		l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+		l.getLine()
+		if line, _ := l.Buffer(); line != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, line)
+		}
+	}
+}
+
+func TestCompleteNonASCII(t *testing.T) {
+	for _, test := range []struct {
+		list            []string
+		input, expected string
+	}{
+		{[]string{"café", "cafè"}, "caf\t", "caf"},
+		{[]string{"café", "cafés"}, "caf\t", "café"},
+		// e with different accents combined with it
+		{[]string{"cafe\u0301", "cafe\u0300"}, "caf\t", "caf"},
+		{[]string{"naïve", "naïf"}, "n\t", "naï"},
+	} {
+		l, _ := newTestReader(test.input)
+		l.SetCompleter(AdaptCompleter(NewSimpleCompleter(test.list)))
+		l.getLine()
+		if line, _ := l.Buffer(); line != test.expected {
+			t.Errorf("%q with %q: expected %q, got %q", test.input, test.list, test.expected, line)
+		}
+	}
+}
@@ -4,57 +4,174 @@ package fineline
 
 import (
 	"bufio"
+	"io"
 	"os"
 	"strings"
+	"time"
 )
 
 // Common, platform-independent components
 type lineReader struct {
-	// The prompt that precedes any line entry
+	// The prompt that precedes any line entry. It can have escape
+	// sequences in it to color it, and can mark any other parts that
+	// don't take up room on the screen by putting them between \001 and
+	// \002, as in readline. If it has several lines, only the last one is
+	// on the same row as the input.
 	Prompt string
+	// RightPrompt, if it's set, is shown at the right end of the row the
+	// input starts on, like zsh's RPROMPT. It's hidden when the input
+	// would run into it. It can be styled like Prompt.
+	RightPrompt string
+	// PromptFunc and RightPromptFunc, if they're set, are called for the
+	// prompts each time the line is drawn, in place of Prompt and
+	// RightPrompt. Refresh draws the line again.
+	PromptFunc      func() string
+	RightPromptFunc func() string
+	// The prompt that precedes each line after the first when the input
+	// is several lines long, like Prompt but on one line. It's "> " by
+	// default.
+	ContinuationPrompt string
+	// Validator, if it's set, is called with the input when enter is
+	// pressed. If it returns false, the input isn't complete, so a newline
+	// is inserted instead and editing goes on.
+	Validator func(input string) bool
+	// How long to wait for the rest of a key sequence, such as an escape
+	// sequence after an escape. If nothing comes, the keys so far are taken
+	// on their own, so this is how a lone escape is told apart from the
+	// start of a sequence. It's 100ms by default.
+	KeyTimeout time.Duration
+	// IsWordChar reports whether r is part of a word, for the commands
+	// that move and edit by word. If it's nil, letters and digits are.
+	IsWordChar func(r rune) bool
+	// When there are at least this many completion candidates to list,
+	// the user is asked first whether to show them all, as with readline's
+	// completion-query-items. It's 100 by default; 0 means never ask.
+	CompletionQueryItems int
+	// Highlighter, if it's set, styles the line whenever it's drawn.
+	Highlighter Highlighter
+	// Hinter, if it's set, suggests text to follow the line. It's
+	// HistoryHint by default.
+	Hinter Hinter
+	// ModeChanged, if it's set, is called whenever the editing mode
+	// changes, such as when escape takes vi from insert to command mode.
+	// It can set Prompt to show the mode; the line is redrawn after.
+	ModeChanged func(mode EditMode)
+	// Name is the name of the program, which inputrc files can test for
+	// with lines like "$if Bash".
+	Name string
+
 	input  *bufio.Reader
+	output io.Writer
+	// file descriptor of the terminal we're attached to
+	fd int
+	// keys pushed back onto the input
+	pending []Key
+	// used to read input in the background; see readRune
+	want    chan struct{}
+	runes   chan runeResult
+	reading bool
+	closed  bool
+	// if it's set, returns the channel that waiting for the rest of a key
+	// sequence times out on, in place of a timer for KeyTimeout
+	keyTimer func(time.Duration) <-chan time.Time
+	// signals that Refresh was called
+	refresh chan struct{}
+	// while set, Refresh and resizes wait to be dealt with
+	hold bool
+	// signals that the terminal's been resized
+	winch chan os.Signal
 
 	// A circular array of history
 	history []string
 	// The most recent line in the history
 	lastEntry int
-	// The index of the line in history currently being shown
+	// The number of lines in history
+	numEntries int
+	// How many lines back from lastEntry the line currently being shown is
 	// -1 if we're not showing something in history.
 	currentEntry int
+	// The line being edited before we started browsing history
+	draft string
+	// The file that history is appended to, if any
+	historyFile string
 
 	buf    buffer
 	// number of lines we last wrote
 	lines     int
 	pos, cols int
-	c         Completer
+	rows      int
+	c         CandidateCompleter
+	// key bindings for each editing mode, and the mode we're in
+	keymaps [3]*keymap
+	mode    EditMode
+	vi      viState
+	// the op being run and the one run before it
+	op, lastOp int
+	killRing   *KillRing
+	// where the last yank put its text
+	yanked [2]int
+	// states of the line for undo and redo
+	undo, redo []undoState
+	// whether the current op has saved an undo state
+	changed bool
 	// candidates from last tab completion
-	candidates []string
+	candidates []Candidate
 	display    bool
-	y          int
+	// how the candidates are shown as a menu under the line, if they
+	// are, which one's selected in it and the first row it shows
+	menu              int
+	selected, menuTop int
+	// where we left the cursor, relative to the start of the prompt
+	x, y int
+	// byte range of the buffer to show highlighted
+	highlight [2]int
+	// the suggestion shown after the line
+	hint string
+	// the prompts as they were last drawn, and the search's prompt while
+	// searching
+	prompt, rightPrompt string
+	searchPrompt        string
+	// the line a search started from and the entry it was recalled from,
+	// which it stands in for while searching, since it may have been edited
+	searchStart string
+	searchEntry int
 }
 
-// NewLineReader creates a new LineReader that reads from stdin.
+// NewLineReader creates a new LineReader that reads from stdin and writes to
+// stdout. It takes the user's settings and key bindings from their inputrc
+// file, as readline does; see LoadInputrc.
 func NewLineReader(c Completer) *LineReader {
-	var l LineReader
-	l.input = bufio.NewReader(os.Stdin)
-	l.Prompt = "$ "
-	l.c = c
-	return &l
+	l := NewTermLineReader(c, os.Stdin, os.Stdout, int(os.Stdin.Fd()))
+	l.LoadInputrc()
+	return l
 }
 
-func (l *LineReader) SetMaxHistory(len int) {
-	l.history = make([]string, len)
-	l.lastEntry = 0
-}
-
-func (l *LineReader) AddHistory(line string) {
-	if len(l.history) > 0 {
-		l.lastEntry++
-		if l.lastEntry >= len(l.history) {
-			l.lastEntry = 0
-		}
-		l.history[l.lastEntry] = line
+// NewTermLineReader creates a new LineReader that reads from in and writes to
+// out. fd is the file descriptor of the terminal behind in and out; it's put
+// into raw mode while reading and queried for the terminal's size.
+// If fd isn't a terminal, Read falls back to reading plain lines from in.
+func NewTermLineReader(c Completer, in io.Reader, out io.Writer, fd int) *LineReader {
+	var l LineReader
+	l.input = bufio.NewReader(in)
+	l.output = out
+	l.fd = fd
+	l.Prompt = "$ "
+	l.ContinuationPrompt = "> "
+	l.Hinter = HinterFunc(l.HistoryHint)
+	l.refresh = make(chan struct{}, 1)
+	l.winch = make(chan os.Signal, 1)
+	l.KeyTimeout = 100 * time.Millisecond
+	l.CompletionQueryItems = 100
+	if c != nil {
+		l.c = AdaptCompleter(c)
 	}
+	l.keymaps = [...]*keymap{
+		EmacsMode:     newKeymap(defaultKeys),
+		ViInsertMode:  newKeymap(viInsertKeys),
+		ViCommandMode: newKeymap(nil),
+	}
+	l.killRing = NewKillRing(10)
+	return &l
 }
 
 var unsupportedTerms = [...]string{"dumb", "cons25"}
@@ -69,15 +186,24 @@ func unsupportedTerm() bool {
 	return false
 }
 
+// Close stops the goroutine l reads input in the background with. If it's
+// waiting for input, it stops once that arrives, which is then lost; l can't
+// be used after.
+func (l *LineReader) Close() error {
+	if !l.closed && l.want != nil {
+		close(l.want)
+	}
+	l.closed = true
+	return nil
+}
+
 func (l *LineReader) Read() (line string, err error) {
-	// TODO: Move these checks to NewLineReader()
-	// TODO: Check if STDIN is a TTY
-	if unsupportedTerm() {
-		// Fall back to plain old stdin reading
-		r := bufio.NewReader(os.Stdin)
-		line, err = r.ReadString('\n')
+	// TODO: Move this check to NewLineReader()
+	if unsupportedTerm() || l.raw() != nil {
+		// Fall back to plain old line reading; either the terminal can't
+		// handle our escape codes or we're not talking to a terminal at all
+		line, err = l.input.ReadString('\n')
 	} else {
-		l.raw()
 		line, err = l.getLine()
 		l.restore()
 		l.buf.reset()
@@ -87,23 +213,32 @@ func (l *LineReader) Read() (line string, err error) {
 }
 
 func (l *LineReader) getLine() (string, error) {
-	r := bufio.NewReader(os.Stdin)
+	l.currentEntry = -1
+	l.draft = ""
+	l.resetUndo()
+	// the line's about to be drawn anyway
+	select {
+	case <-l.refresh:
+	default:
+	}
+	if l.mode == ViCommandMode {
+		l.setMode(ViInsertMode)
+	}
 	l.refreshLine()
 	var err error
 	cont := true
 	for cont && err == nil {
-		var c rune
-		c, _, err = r.ReadRune()
+		var b binding
+		var k Key
+		if l.mode == ViCommandMode {
+			cont, err = l.viCommand()
+			continue
+		}
+		b, k, err = l.readBinding(l.keymap())
 		if err != nil {
 			return "", err
 		}
-		var op int
-		if int(c) < len(keyMap) {
-			op = keyMap[c]
-		} else {
-			op = opPutc
-		}
-		cont, err = l.exec(r, op, c)
+		cont, err = l.run(b, k)
 	}
 	if err == cancelled {
 		return "", nil
@@ -0,0 +1,123 @@
+package fineline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// newTestReader returns a LineReader that reads keys from input and renders
+// to a buffer, as if attached to an 80 column terminal.
+func newTestReader(input string) (*LineReader, *bytes.Buffer) {
+	out := new(bytes.Buffer)
+	l := NewTermLineReader(nil, strings.NewReader(input), out, -1)
+	l.cols = 80
+	return l, out
+}
+
+func TestReadNotTerminal(t *testing.T) {
+	l, out := newTestReader("hello\nworld\n")
+	for _, expected := range []string{"hello\n", "world\n"} {
+		line, err := l.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expected {
+			t.Errorf("expected %q, got %q", expected, line)
+		}
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output, got %q", out.String())
+	}
+}
+
+func TestGetLine(t *testing.T) {
+	l, _ := newTestReader("hello\x02\x02\x02XY\x05!\r")
+	line, err := l.getLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "heXYllo!\n" {
+		t.Errorf("expected %q, got %q", "heXYllo!\n", line)
+	}
+}
+
+// complete once the input ends with a semicolon
+func semicolon(input string) bool {
+	return strings.HasSuffix(input, ";")
+}
+
+func TestMultiLine(t *testing.T) {
+	for _, test := range []struct{ input, expected string }{
+		{"abc\rde;\r", "abc\nde;\n"},
+		// enter in the middle of the input breaks the line there
+		{"abc\x02\x02\r\x05;\r", "a\nbc;\n"},
+		// up and down keep the column, as near as they can
+		{"abc\rde\x10X\x0e\x05;\r", "abXc\nde;\n"},
+		{"abcdef\r\x10\x05X\x0eY;\r", "abcdefX\nY;\n"},
+		// home and end go to the ends of the line the cursor's on
+		{"abc\rdef\x01X\x10\x05Y\x0e\x05;\r", "abcY\nXdef;\n"},
+	} {
+		l, _ := newTestReader(test.input)
+		l.Validator = semicolon
+		if line, _ := l.getLine(); line != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, line)
+		}
+	}
+}
+
+func TestMultiLineHistory(t *testing.T) {
+	l, _ := newTestReader("x\rz\x10\x10\x10\x0e\x0e\x0e;\r")
+	l.Validator = semicolon
+	l.SetMaxHistory(10)
+	l.AddHistory("a\nb")
+	// the first up moves to the first line; the second goes back in
+	// history, to the last line of the entry, and the third goes up in it
+	if line, _ := l.getLine(); line != "x\nz;\n" {
+		t.Errorf("expected %q, got %q", "x\nz;\n", line)
+	}
+}
+
+func TestMultiLineRender(t *testing.T) {
+	l, out := newTestReader("abc\rde")
+	l.Validator = semicolon
+	l.getLine()
+	if !strings.HasSuffix(out.String(), "$ abc\x1b[K\r\n> de\x1b[0J\x1b[5G") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if l.x != 4 || l.y != 1 || l.lines != 1 {
+		t.Errorf("expected the cursor at 4,1 of 1, got %d,%d of %d", l.x, l.y, l.lines)
+	}
+}
+
+func TestReflow(t *testing.T) {
+	for _, test := range []struct {
+		input       string
+		rightPrompt string
+		cols        int
+		up          string
+	}{
+		// 28 columns of prompt and input take two rows at 20 columns, three at
+		// 10 and one at 40
+		{"abcdefghijklmnopqrstuvwxyz", "", 10, "\x1b[2A"},
+		{"abcdefghijklmnopqrstuvwxyz", "", 40, ""},
+		// the right prompt wraps onto a row of its own
+		{"ab\rcd", "[rp]", 10, "\x1b[2A"},
+		{"ab\rcd", "", 10, "\x1b[1A"},
+	} {
+		l, out := newTestReader(test.input)
+		l.cols = 20
+		l.RightPrompt = test.rightPrompt
+		l.Validator = semicolon
+		l.getLine()
+		out.Reset()
+		l.reflow(test.cols)
+		if !strings.HasPrefix(out.String(), "\x1b[1G"+test.up+"$ ") {
+			t.Errorf("%q at %d columns: expected to go up %q, got %q", test.input, test.cols, test.up, out.String())
+		}
+		x, y := l.cursorPos(l.promptEnd(l.prompt))
+		if l.cols != test.cols || l.x != x || l.y != y {
+			t.Errorf("%q at %d columns: expected the cursor at %d,%d, got %d,%d", test.input, test.cols, x, y, l.x, l.y)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package fineline
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Grapheme cluster break properties from UAX #29
+const (
+	gbOther = iota
+	gbCR
+	gbLF
+	gbControl
+	gbExtend
+	gbZWJ
+	gbRegionalIndicator
+	gbPrepend
+	gbSpacingMark
+	gbL
+	gbV
+	gbT
+	gbLV
+	gbLVT
+)
+
+type runeRange struct{ lo, hi rune }
+
+// characters with the Extended_Pictographic property, which covers emoji
+var pictographic = []runeRange{
+	{0x00a9, 0x00a9}, {0x00ae, 0x00ae}, {0x203c, 0x203c}, {0x2049, 0x2049},
+	{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x2199}, {0x21a9, 0x21aa},
+	{0x231a, 0x231b}, {0x2328, 0x2328}, {0x2388, 0x2388}, {0x23cf, 0x23cf},
+	{0x23e9, 0x23f3}, {0x23f8, 0x23fa}, {0x24c2, 0x24c2}, {0x25aa, 0x25ab},
+	{0x25b6, 0x25b6}, {0x25c0, 0x25c0}, {0x25fb, 0x25fe}, {0x2600, 0x2605},
+	{0x2607, 0x2612}, {0x2614, 0x2685}, {0x2690, 0x2705}, {0x2708, 0x2712},
+	{0x2714, 0x2714}, {0x2716, 0x2716}, {0x271d, 0x271d}, {0x2721, 0x2721},
+	{0x2728, 0x2728}, {0x2733, 0x2734}, {0x2744, 0x2744}, {0x2747, 0x2747},
+	{0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755}, {0x2757, 0x2757},
+	{0x2763, 0x2767}, {0x2795, 0x2797}, {0x27a1, 0x27a1}, {0x27b0, 0x27b0},
+	{0x27bf, 0x27bf}, {0x2934, 0x2935}, {0x2b05, 0x2b07}, {0x2b1b, 0x2b1c},
+	{0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x3030, 0x3030}, {0x303d, 0x303d},
+	{0x3297, 0x3297}, {0x3299, 0x3299}, {0x1f000, 0x1f0ff}, {0x1f10d, 0x1f10f},
+	{0x1f12f, 0x1f12f}, {0x1f16c, 0x1f171}, {0x1f17e, 0x1f17f}, {0x1f18e, 0x1f18e},
+	{0x1f191, 0x1f19a}, {0x1f1ad, 0x1f1e5}, {0x1f201, 0x1f20f}, {0x1f21a, 0x1f21a},
+	{0x1f22f, 0x1f22f}, {0x1f232, 0x1f23a}, {0x1f23c, 0x1f23f}, {0x1f249, 0x1f3fa},
+	{0x1f400, 0x1f53d}, {0x1f546, 0x1f64f}, {0x1f680, 0x1f6ff}, {0x1f774, 0x1f77f},
+	{0x1f7d5, 0x1f7ff}, {0x1f80c, 0x1f80f}, {0x1f848, 0x1f84f}, {0x1f85a, 0x1f85f},
+	{0x1f888, 0x1f88f}, {0x1f8ae, 0x1f8ff}, {0x1f90c, 0x1f93a}, {0x1f93c, 0x1f945},
+	{0x1f947, 0x1faff}, {0x1fc00, 0x1fffd},
+}
+
+// format characters that attach to the following character
+var prepend = []runeRange{
+	{0x0600, 0x0605}, {0x06dd, 0x06dd}, {0x070f, 0x070f}, {0x0890, 0x0891},
+	{0x08e2, 0x08e2}, {0x0d4e, 0x0d4e}, {0x110bd, 0x110bd}, {0x110cd, 0x110cd},
+	{0x111c2, 0x111c3},
+}
+
+func inRanges(r rune, ranges []runeRange) bool {
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].hi >= r })
+	return i < len(ranges) && ranges[i].lo <= r
+}
+
+func isPictographic(r rune) bool {
+	return r >= 0xa9 && inRanges(r, pictographic)
+}
+
+// returns r's Grapheme_Cluster_Break property
+func graphemeBreak(r rune) int {
+	switch {
+	case r == '\r':
+		return gbCR
+	case r == '\n':
+		return gbLF
+	case r < ' ' || r == 0x7f:
+		return gbControl
+	case r < 0x300:
+		if 0x80 <= r && r < 0xa0 || r == 0xad {
+			return gbControl
+		}
+		return gbOther
+	case r == 0x200d:
+		return gbZWJ
+	case r == 0x200c || 0xff9e <= r && r <= 0xff9f ||
+		0x1f3fb <= r && r <= 0x1f3ff || 0xe0020 <= r && r <= 0xe007f:
+		// non-joiner, halfwidth sound marks, emoji skin tones, and tags
+		return gbExtend
+	case 0x1f1e6 <= r && r <= 0x1f1ff:
+		return gbRegionalIndicator
+	case 0x1100 <= r && r <= 0x115f || 0xa960 <= r && r <= 0xa97c:
+		return gbL
+	case 0x1160 <= r && r <= 0x11a7 || 0xd7b0 <= r && r <= 0xd7c6:
+		return gbV
+	case 0x11a8 <= r && r <= 0x11ff || 0xd7cb <= r && r <= 0xd7fb:
+		return gbT
+	case 0xac00 <= r && r <= 0xd7a3:
+		if (r-0xac00)%28 == 0 {
+			return gbLV
+		}
+		return gbLVT
+	case inRanges(r, prepend):
+		return gbPrepend
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return gbExtend
+	case unicode.Is(unicode.Mc, r) || r == 0x0e33 || r == 0x0eb3:
+		return gbSpacingMark
+	case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Zl, unicode.Zp):
+		return gbControl
+	}
+	return gbOther
+}
+
+// nextGrapheme returns the end of the grapheme cluster that starts at pos in
+// s, following the rules of UAX #29.
+func nextGrapheme(s string, pos int) int {
+	if pos >= len(s) {
+		return len(s)
+	}
+	r, n := utf8.DecodeRuneInString(s[pos:])
+	prev := graphemeBreak(r)
+	// whether we're in an emoji sequence that a ZWJ can join onto
+	emoji := isPictographic(r)
+	ri := 0
+	if prev == gbRegionalIndicator {
+		ri = 1
+	}
+	for pos += n; pos < len(s); pos += n {
+		r, n = utf8.DecodeRuneInString(s[pos:])
+		next := graphemeBreak(r)
+		switch {
+		case prev == gbCR && next == gbLF: // GB3
+		case prev == gbCR || prev == gbLF || prev == gbControl: // GB4
+			return pos
+		case next == gbCR || next == gbLF || next == gbControl: // GB5
+			return pos
+		case prev == gbL && (next == gbL || next == gbV || next == gbLV || next == gbLVT): // GB6
+		case (prev == gbLV || prev == gbV) && (next == gbV || next == gbT): // GB7
+		case (prev == gbLVT || prev == gbT) && next == gbT: // GB8
+		case next == gbExtend || next == gbZWJ || next == gbSpacingMark: // GB9, GB9a
+		case prev == gbPrepend: // GB9b
+		case prev == gbZWJ && emoji && isPictographic(r): // GB11
+		case prev == gbRegionalIndicator && next == gbRegionalIndicator && ri%2 == 1: // GB12, GB13
+		default: // GB999
+			return pos
+		}
+		if next == gbRegionalIndicator {
+			ri++
+		} else {
+			ri = 0
+		}
+		if next != gbExtend && next != gbZWJ {
+			emoji = isPictographic(r)
+		}
+		prev = next
+	}
+	return pos
+}
+
+// prevGrapheme returns the start of the grapheme cluster that ends at pos in
+// s. Clusters can only be found reliably going forward, so this starts at
+// the beginning of the line.
+func prevGrapheme(s string, pos int) int {
+	// a line feed always starts a cluster of its own
+	start := strings.LastIndexByte(s[:pos], '\n')
+	if start < 0 {
+		start = 0
+	} else if start > 0 && s[start-1] == '\r' {
+		start--
+	}
+	for {
+		end := nextGrapheme(s, start)
+		if end >= pos {
+			return start
+		}
+		start = end
+	}
+}
+
+// returns the number of columns the grapheme cluster g takes up on a
+// terminal; it's as wide as its first visible character, or two columns for
+// a flag or an emoji turned into a picture by a variation selector
+func graphemeWidth(g string) int {
+	w := 0
+	for i, r := range g {
+		if i == 0 && isControl(r) {
+			return 2
+		}
+		if i > 0 && graphemeBreak(r) == gbRegionalIndicator {
+			return 2
+		}
+		if w == 0 {
+			w = runeWidth(r)
+		}
+		if r == 0xfe0f && w == 1 && isPictographic([]rune(g)[0]) {
+			return 2
+		}
+	}
+	return w
+}
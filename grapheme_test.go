@@ -0,0 +1,77 @@
+package fineline
+
+import (
+	"testing"
+)
+
+var graphemeTests = []struct {
+	s        string
+	clusters []string
+}{
+	{"abc", []string{"a", "b", "c"}},
+	{"e\u0301x", []string{"e\u0301", "x"}},
+	{"\r\n\n", []string{"\r\n", "\n"}},
+	{"a\u0308\u0301b", []string{"a\u0308\u0301", "b"}},
+	// flags are pairs of regional indicators
+	{"\U0001f1fa\U0001f1f8\U0001f1eb\U0001f1f7\U0001f1e9", []string{"\U0001f1fa\U0001f1f8", "\U0001f1eb\U0001f1f7", "\U0001f1e9"}},
+	// family: man, ZWJ, woman, ZWJ, girl
+	{"\U0001f468\u200d\U0001f469\u200d\U0001f467!", []string{"\U0001f468\u200d\U0001f469\u200d\U0001f467", "!"}},
+	// thumbs up with a skin tone
+	{"\U0001f44d\U0001f3fd\U0001f44d", []string{"\U0001f44d\U0001f3fd", "\U0001f44d"}},
+	// a ZWJ only joins emoji
+	{"a\u200d\U0001f469", []string{"a\u200d", "\U0001f469"}},
+	// Hangul syllables made of jamo, and an LV syllable with a final jamo
+	{"\u1100\u1161\u11a8\u1100", []string{"\u1100\u1161\u11a8", "\u1100"}},
+	{"\uac00\u11a8\uac01", []string{"\uac00\u11a8", "\uac01"}},
+	// Devanagari with a spacing mark
+	{"\u0915\u093f\u0915", []string{"\u0915\u093f", "\u0915"}},
+	{"\u0600\u0661", []string{"\u0600\u0661"}},
+	{"\u2764\ufe0f", []string{"\u2764\ufe0f"}},
+}
+
+func TestGraphemes(t *testing.T) {
+	for _, test := range graphemeTests {
+		var clusters []string
+		for i := 0; i < len(test.s); {
+			j := nextGrapheme(test.s, i)
+			clusters = append(clusters, test.s[i:j])
+			i = j
+		}
+		if !listsEqual(clusters, test.clusters) {
+			t.Errorf("%+q: expected %+q, got %+q", test.s, test.clusters, clusters)
+			continue
+		}
+		// and the same going backwards
+		pos := len(test.s)
+		for i := len(clusters) - 1; i >= 0; i-- {
+			start := prevGrapheme(test.s, pos)
+			if test.s[start:pos] != clusters[i] {
+				t.Errorf("%+q: expected %+q going backwards, got %+q", test.s, clusters[i], test.s[start:pos])
+				break
+			}
+			pos = start
+		}
+	}
+}
+
+var graphemeEditTests = []struct {
+	input    string
+	expected string
+}{
+	{"ae\u0301\x08", "a"},
+	{"\U0001f468\u200d\U0001f469\u200d\U0001f467x\x02\x08", "x"},
+	{"\U0001f1fa\U0001f1f8\U0001f1eb\U0001f1f7\x02\x02\x04", "\U0001f1eb\U0001f1f7"},
+	{"e\u0301a\x14", "ae\u0301"},
+	{"e\u0301\U0001f44d\U0001f3fd\x02\x02!", "!e\u0301\U0001f44d\U0001f3fd"},
+	{"ab\U0001f44d\U0001f3fd\x02\x1b[3~", "ab"},
+}
+
+func TestGraphemeEditing(t *testing.T) {
+	for _, test := range graphemeEditTests {
+		l, _ := newTestReader(test.input)
+		l.getLine()
+		if line, _ := l.Buffer(); line != test.expected {
+			t.Errorf("%+q: expected %+q, got %+q", test.input, test.expected, line)
+		}
+	}
+}
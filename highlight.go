@@ -0,0 +1,56 @@
+package fineline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Highlighter styles the line being edited, such as to color keywords.
+type Highlighter interface {
+	// Highlight returns line with ANSI escape sequences added to style
+	// it, like "\x1b[1mSELECT\x1b[0m 1". The text itself mustn't change;
+	// if it does, the line is shown without styles.
+	Highlight(line string) string
+}
+
+// HighlighterFunc lets an ordinary function be used as a Highlighter.
+type HighlighterFunc func(line string) string
+
+func (f HighlighterFunc) Highlight(line string) string {
+	return f(line)
+}
+
+// write the buffer out styled by the Highlighter, returning false if it
+// can't be
+func (l *LineReader) writeHighlighted(x int) bool {
+	str := l.buf.String()
+	s := l.Highlighter.Highlight(str)
+	if stripEscapes(s) != str {
+		return false
+	}
+	// the styles in effect, to carry on after a continuation prompt
+	var style string
+	for s != "" {
+		i := strings.IndexByte(s, 0x1b)
+		if i < 0 {
+			i = len(s)
+		}
+		x = l.writeText(s[:i], x, style)
+		s = s[i:]
+		if s == "" {
+			break
+		}
+		n := escapeLen(s)
+		seq := s[:n]
+		s = s[n:]
+		fmt.Fprint(l.output, seq)
+		switch {
+		case seq == "\x1b[m" || seq == "\x1b[0m":
+			style = ""
+		case strings.HasPrefix(seq, "\x1b[") && strings.HasSuffix(seq, "m"):
+			style += seq
+		}
+	}
+	fmt.Fprint(l.output, "\x1b[0m")
+	return true
+}
@@ -0,0 +1,58 @@
+package fineline
+
+import (
+	"strings"
+	"testing"
+)
+
+// make every "x" bold
+var boldX = HighlighterFunc(func(line string) string {
+	return strings.Replace(line, "x", "\x1b[1mx\x1b[0m", -1)
+})
+
+func TestHighlight(t *testing.T) {
+	l, out := newTestReader("axb\x02")
+	l.Highlighter = boldX
+	l.getLine()
+	if !strings.HasSuffix(out.String(), "$ a\x1b[1mx\x1b[0mb\x1b[0m\x1b[0J\x1b[5G") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	// the cursor goes by the text, not the escapes
+	if l.x != 4 {
+		t.Errorf("expected the cursor at 4, got %d", l.x)
+	}
+}
+
+func TestHighlightChangesText(t *testing.T) {
+	l, out := newTestReader("ab")
+	l.Highlighter = HighlighterFunc(strings.ToUpper)
+	l.getLine()
+	if !strings.HasSuffix(out.String(), "$ ab\x1b[0J\x1b[5G") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestHighlightMultiLine(t *testing.T) {
+	l, out := newTestReader("\"a\rb\"")
+	l.Validator = semicolon
+	l.Highlighter = HighlighterFunc(func(line string) string {
+		return "\x1b[32m" + line + "\x1b[0m"
+	})
+	l.getLine()
+	// the string's style is turned off for the prompt and back on after
+	expected := "$ \x1b[32m\"a\x1b[0m\x1b[K\r\n> \x1b[32mb\"\x1b[0m\x1b[0m\x1b[0J"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected %q in output %q", expected, out.String())
+	}
+}
+
+func TestHighlightSearch(t *testing.T) {
+	l, out := newTestReader("\x12x")
+	l.SetMaxHistory(10)
+	l.AddHistory("axb")
+	l.Highlighter = boldX
+	l.getLine()
+	if !strings.HasSuffix(out.String(), "a\x1b[7mx\x1b[0mb\x1b[0J\x1b[25G") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
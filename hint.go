@@ -0,0 +1,83 @@
+package fineline
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Hinter suggests how the line might go on. The suggestion is shown
+// greyed out after the cursor, as in fish, and can be accepted with the
+// right arrow or end key, or a word at a time with alt-f.
+type Hinter interface {
+	// Hint returns the text to suggest adding to the end of line, or ""
+	// for none.
+	Hint(line string) string
+}
+
+// HinterFunc lets an ordinary function be used as a Hinter.
+type HinterFunc func(line string) string
+
+func (f HinterFunc) Hint(line string) string {
+	return f(line)
+}
+
+// how hints are drawn: bright black, which is grey in most color schemes
+const hintStyle = "\x1b[90m"
+
+// HistoryHint suggests the rest of the most recent history entry that
+// starts with line. It's the default Hinter.
+func (l *LineReader) HistoryHint(line string) string {
+	for n := 0; n < l.numEntries; n++ {
+		if entry := l.historyEntry(n); len(entry) > len(line) && strings.HasPrefix(entry, line) {
+			return entry[len(line):]
+		}
+	}
+	return ""
+}
+
+// work out the hint to show, if any: only with the cursor at the end of a
+// line that's being edited, and not while a menu of candidates is shown
+func (l *LineReader) updateHint() {
+	l.hint = ""
+	switch l.op {
+	case opSubmit, opSearchBackward, opSearchForward:
+		return
+	}
+	if l.Hinter != nil && l.menu == noMenu && l.buf.len() > 0 && l.pos == l.buf.len() {
+		l.hint = l.Hinter.Hint(l.buf.String())
+	}
+}
+
+// write the hint after the line, which ends at column x
+func (l *LineReader) writeHint(x int) {
+	fmt.Fprint(l.output, hintStyle)
+	l.writeText(l.hint, x, hintStyle)
+	fmt.Fprint(l.output, "\x1b[0m")
+}
+
+// accept the hint, or just its first word, if one's showing
+func (l *LineReader) acceptHint(word bool) bool {
+	if l.hint == "" || l.pos != l.buf.len() {
+		return false
+	}
+	s := l.hint
+	if word {
+		i := 0
+		for i < len(s) && !l.startsWord(s[i:]) {
+			i = nextGrapheme(s, i)
+		}
+		for i < len(s) && l.startsWord(s[i:]) {
+			i = nextGrapheme(s, i)
+		}
+		s = s[:i]
+	}
+	l.puts(s)
+	return true
+}
+
+// reports whether s starts with a word character
+func (l *lineReader) startsWord(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return l.isWordChar(r)
+}
@@ -0,0 +1,69 @@
+package fineline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistoryHint(t *testing.T) {
+	for _, test := range []struct{ input, expected string }{
+		{"he\r", "he\n"},
+		{"he\x1b[C\r", "hello world\n"},
+		{"he\x05\r", "hello world\n"},
+		{"he\x06\r", "hello world\n"},
+		{"he\x1bf\r", "hello\n"},
+		{"he\x1bf\x1bf\r", "hello world\n"},
+		{"hi\x1b[C\r", "hi\n"},
+		{"help\x1b[C\r", "help\n"},
+		// no hint unless the cursor's at the end
+		{"hex\x02\x1b[Cy\r", "hexy\n"},
+	} {
+		l, _ := newTestReader(test.input)
+		l.SetMaxHistory(10)
+		l.AddHistory("help")
+		l.AddHistory("hello world")
+		if line, _ := l.getLine(); line != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, line)
+		}
+	}
+}
+
+func TestHintRender(t *testing.T) {
+	l, out := newTestReader("hel")
+	l.SetMaxHistory(10)
+	l.AddHistory("hello")
+	l.getLine()
+	if !strings.HasSuffix(out.String(), "$ hel\x1b[90mlo\x1b[0m\x1b[0J\x1b[6G") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	// the hint's gone once the line's submitted
+	l, out = newTestReader("hel\r")
+	l.SetMaxHistory(10)
+	l.AddHistory("hello")
+	l.getLine()
+	if !strings.HasSuffix(out.String(), "$ hel\x1b[0J\x1b[6G\r\n") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestHinter(t *testing.T) {
+	l, _ := newTestReader("SEL\x1b[C 1\r")
+	l.Hinter = HinterFunc(func(line string) string {
+		if strings.HasPrefix("SELECT", line) {
+			return "SELECT"[len(line):]
+		}
+		return ""
+	})
+	if line, _ := l.getLine(); line != "SELECT 1\n" {
+		t.Errorf("expected %q, got %q", "SELECT 1\n", line)
+	}
+
+	l, _ = newTestReader("he\x1b[C\r")
+	l.SetMaxHistory(10)
+	l.AddHistory("hello")
+	l.Hinter = nil
+	if line, _ := l.getLine(); line != "he\n" {
+		t.Errorf("expected %q, got %q", "he\n", line)
+	}
+}
@@ -0,0 +1,224 @@
+package fineline
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// SetMaxHistory sets the number of lines kept in history. The most recent
+// lines are kept if the history shrinks.
+func (l *LineReader) SetMaxHistory(n int) {
+	if n < 0 {
+		n = 0
+	}
+	keep := l.numEntries
+	if keep > n {
+		keep = n
+	}
+	history := make([]string, n)
+	for i := 0; i < keep; i++ {
+		history[keep-1-i] = l.historyEntry(i)
+	}
+	l.history = history
+	l.numEntries = keep
+	l.lastEntry = 0
+	if keep > 0 {
+		l.lastEntry = keep - 1
+	}
+	l.currentEntry = -1
+}
+
+// AddHistory adds line to the history. If the history is full, the oldest
+// line is discarded. If there's a history file, the line is also appended to
+// it; errors writing the file are ignored.
+func (l *LineReader) AddHistory(line string) {
+	if len(l.history) == 0 {
+		return
+	}
+	l.addHistory(line)
+	if l.historyFile != "" {
+		l.appendHistoryFile(line)
+	}
+}
+
+func (l *LineReader) addHistory(line string) {
+	if len(l.history) > 0 {
+		l.lastEntry++
+		if l.lastEntry >= len(l.history) {
+			l.lastEntry = 0
+		}
+		l.history[l.lastEntry] = line
+		if l.numEntries < len(l.history) {
+			l.numEntries++
+		}
+	}
+}
+
+// returns the line n lines back from the most recent one
+func (l *lineReader) historyEntry(n int) string {
+	i := l.lastEntry - n
+	if i < 0 {
+		i += len(l.history)
+	}
+	return l.history[i]
+}
+
+// show the next older line in history, saving the line being edited if we're
+// just starting to browse
+func (l *LineReader) historyPrev() {
+	if l.currentEntry+1 >= l.numEntries {
+		return
+	}
+	if l.currentEntry < 0 {
+		l.draft = l.buf.String()
+	}
+	l.currentEntry++
+	l.setLine(l.historyEntry(l.currentEntry))
+}
+
+// show the next newer line in history, or the saved line if we step past the
+// most recent one
+func (l *LineReader) historyNext() {
+	if l.currentEntry < 0 {
+		return
+	}
+	l.currentEntry--
+	if l.currentEntry < 0 {
+		l.setLine(l.draft)
+	} else {
+		l.setLine(l.historyEntry(l.currentEntry))
+	}
+}
+
+// LoadHistory reads lines from r and adds them to the history, oldest first.
+// Like AddHistory, it does nothing useful until SetMaxHistory has been called.
+func (l *LineReader) LoadHistory(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l.addHistory(unescapeHistory(s.Text()))
+	}
+	return s.Err()
+}
+
+// SaveHistory writes the history to w, one line at a time, oldest first.
+func (l *LineReader) SaveHistory(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i := l.numEntries - 1; i >= 0; i-- {
+		bw.WriteString(escapeHistory(l.historyEntry(i)))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// SetHistoryFile loads the history from the named file and makes l append
+// every line passed to AddHistory to the file. The file is locked while it's
+// read or written so several processes can share it, and it's cut down to the
+// size set by SetMaxHistory whenever it grows past it.
+// The file is created if it doesn't exist. SetMaxHistory should be called
+// first; the file isn't cut down while the history size is zero.
+func (l *LineReader) SetHistoryFile(name string) error {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+	lines, err := readHistoryFile(f)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		l.addHistory(unescapeHistory(line))
+	}
+	if err := l.trimHistoryFile(f, lines); err != nil {
+		return err
+	}
+	l.historyFile = name
+	return nil
+}
+
+// append line to the history file, if there is one
+func (l *LineReader) appendHistoryFile(line string) error {
+	f, err := os.OpenFile(l.historyFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+	if _, err := f.WriteString(escapeHistory(line) + "\n"); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	lines, err := readHistoryFile(f)
+	if err != nil {
+		return err
+	}
+	return l.trimHistoryFile(f, lines)
+}
+
+// rewrite f with only the most recent lines if it has more than we keep
+func (l *LineReader) trimHistoryFile(f *os.File, lines []string) error {
+	if len(l.history) == 0 || len(lines) <= len(l.history) {
+		return nil
+	}
+	lines = lines[len(lines)-len(l.history):]
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	for _, line := range lines {
+		bw.WriteString(line)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+func readHistoryFile(f *os.File) ([]string, error) {
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines, s.Err()
+}
+
+// Lines may contain newlines, so they're escaped when written out.
+func escapeHistory(line string) string {
+	if !strings.ContainsAny(line, "\\\n") {
+		return line
+	}
+	line = strings.Replace(line, "\\", "\\\\", -1)
+	return strings.Replace(line, "\n", "\\n", -1)
+}
+
+func unescapeHistory(line string) string {
+	if strings.IndexByte(line, '\\') < 0 {
+		return line
+	}
+	b := make([]byte, 0, len(line))
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) {
+			i++
+			c = line[i]
+			if c == 'n' {
+				c = '\n'
+			}
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
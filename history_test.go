@@ -0,0 +1,190 @@
+package fineline
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var historyTests = []struct {
+	max      int
+	input    string
+	expected string
+}{
+	{3, "\x10\r", "d\n"},
+	{3, "\x10\x10\r", "c\n"},
+	{3, "\x1b[A\x1b[A\x1b[A\x1b[A\x1b[A\r", "b\n"},
+	{3, "\x10\x10\x0e\r", "d\n"},
+	{3, "xy\x10\x10\x0e\x0e\r", "xy\n"},
+	{3, "xy\x1b[A\x1b[B\x1b[B\r", "xy\n"},
+	{3, "\x10!\r", "d!\n"},
+	{1, "\x10\x10\r", "d\n"},
+	{1, "x\x10\x0e\r", "x\n"},
+	{0, "x\x10\r", "x\n"},
+	{10, "\x10\x10\x10\x10\x10\r", "a\n"},
+}
+
+func TestHistoryNavigation(t *testing.T) {
+	for _, test := range historyTests {
+		l, _ := newTestReader(test.input)
+		l.SetMaxHistory(test.max)
+		for _, line := range []string{"a", "b", "c", "d"} {
+			l.AddHistory(line)
+		}
+		line, err := l.getLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != test.expected {
+			t.Errorf("max %d, input %q: expected %q, got %q", test.max, test.input, test.expected, line)
+		}
+	}
+}
+
+func TestSetMaxHistoryKeepsRecent(t *testing.T) {
+	l, _ := newTestReader("")
+	l.SetMaxHistory(5)
+	for _, line := range []string{"a", "b", "c", "d"} {
+		l.AddHistory(line)
+	}
+	l.SetMaxHistory(2)
+	if l.numEntries != 2 || l.historyEntry(0) != "d" || l.historyEntry(1) != "c" {
+		t.Errorf("expected [c d], got %d entries", l.numEntries)
+	}
+	l.SetMaxHistory(4)
+	l.AddHistory("e")
+	for i, expected := range []string{"e", "d", "c"} {
+		if entry := l.historyEntry(i); entry != expected {
+			t.Errorf("entry %d: expected %q, got %q", i, expected, entry)
+		}
+	}
+}
+
+func TestSaveLoadHistory(t *testing.T) {
+	lines := []string{"a", "multi\nline", `back\slash`, `\n`}
+	l, _ := newTestReader("")
+	l.SetMaxHistory(10)
+	for _, line := range lines {
+		l.AddHistory(line)
+	}
+	var buf bytes.Buffer
+	if err := l.SaveHistory(&buf); err != nil {
+		t.Fatal(err)
+	}
+	l2, _ := newTestReader("")
+	l2.SetMaxHistory(10)
+	if err := l2.LoadHistory(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if l2.numEntries != len(lines) {
+		t.Fatalf("expected %d entries, got %d", len(lines), l2.numEntries)
+	}
+	for i, line := range lines {
+		if entry := l2.historyEntry(len(lines) - 1 - i); entry != line {
+			t.Errorf("expected %q, got %q", line, entry)
+		}
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(name, []byte("a\nb\nc\nd\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l1, _ := newTestReader("")
+	l1.SetMaxHistory(3)
+	if err := l1.SetHistoryFile(name); err != nil {
+		t.Fatal(err)
+	}
+	l2, _ := newTestReader("")
+	l2.SetMaxHistory(3)
+	if err := l2.SetHistoryFile(name); err != nil {
+		t.Fatal(err)
+	}
+	l1.AddHistory("e")
+	l2.AddHistory("f")
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "d\ne\nf\n" {
+		t.Errorf("expected file %q, got %q", "d\ne\nf\n", data)
+	}
+	if entry := l1.historyEntry(1); entry != "d" {
+		t.Errorf("expected %q, got %q", "d", entry)
+	}
+}
+
+var searchTests = []struct {
+	input    string
+	expected string
+}{
+	{"\x12fo\r", "food\n"},
+	{"\x12fo\x12\r", "foo bar\n"},
+	{"\x12fo\x12\x12\r", "foo bar\n"},
+	{"\x12fo\x12\x13\r", "food\n"},
+	{"\x12o\x12\x12\r", "food\n"},
+	{"\x12o\x12\x12\x12\r", "foo bar\n"},
+	{"\x12fox\x08\r", "food\n"},
+	{"\x12fo\x12\x08\r", "food\n"},
+	{"x\x12fo\x07\r", "x\n"},
+	{"\x12ba\x01!\r", "!baz\n"},
+	{"\x10\x10\x12ba\x05\x0e\r", "food\n"},
+}
+
+func TestSearch(t *testing.T) {
+	for _, test := range searchTests {
+		l, _ := newTestReader(test.input)
+		l.SetMaxHistory(10)
+		for _, line := range []string{"foo bar", "baz", "food", "other"} {
+			l.AddHistory(line)
+		}
+		line, err := l.getLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != test.expected {
+			t.Errorf("input %q: expected %q, got %q", test.input, test.expected, line)
+		}
+	}
+}
+
+func TestSearchEdited(t *testing.T) {
+	for _, test := range []struct {
+		history, input, expected string
+	}{
+		// the search starts from the line as it's been edited, not as
+		// it is in the history
+		{"ab", "\x10cdef\x12\r", "abcdef\n"},
+		{"hello", "\x10\x15xyz\x12\x1b[C\r", "xyz\n"},
+		{"hello", "\x10\x15xyz\x12he\x07\r", "xyz\n"},
+		// and the edited line stands in for the entry it came from
+		{"hello", "\x10\x15xyz\x12he\r", "xyz\n"},
+	} {
+		l, _ := newTestReader(test.input)
+		l.SetMaxHistory(10)
+		l.AddHistory(test.history)
+		if line, err := l.getLine(); err != nil || line != test.expected {
+			t.Errorf("input %q: expected %q, got %q, %v", test.input, test.expected, line, err)
+		}
+	}
+}
+
+func TestSearchPrompt(t *testing.T) {
+	l, out := newTestReader("\x12fo\x12x\r")
+	l.SetMaxHistory(10)
+	l.AddHistory("food")
+	if _, err := l.getLine(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"(reverse-i-search)`fo': \x1b[7mfo\x1b[0mod", "(failed reverse-i-search)`fox': "} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected output to contain %q", s)
+		}
+	}
+	if l.Prompt != "$ " {
+		t.Errorf("prompt wasn't restored: %q", l.Prompt)
+	}
+}
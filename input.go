@@ -0,0 +1,126 @@
+package fineline
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+var (
+	// returned by readRune when Refresh asks for the line to be redrawn
+	errRefresh = errors.New("fineline: refresh")
+	// returned by readRune when the terminal's been resized
+	errResize = errors.New("fineline: resize")
+	// returned by readRune after Close
+	errClosed = errors.New("fineline: LineReader closed")
+)
+
+type runeResult struct {
+	r   rune
+	err error
+}
+
+// read runes from the input whenever they're asked for; this runs in its own
+// goroutine so that waiting for input can time out
+func (l *lineReader) readInput() {
+	for range l.want {
+		r, _, err := l.input.ReadRune()
+		l.runes <- runeResult{r, err}
+	}
+}
+
+// read a rune from the input. Unless block is set, give up and return
+// errTimeout if nothing arrives within KeyTimeout.
+func (l *lineReader) readRune(block bool) (rune, error) {
+	if l.closed {
+		return 0, errClosed
+	}
+	if !l.reading && l.input.Buffered() > 0 {
+		r, _, err := l.input.ReadRune()
+		return r, err
+	}
+	if !block && l.KeyTimeout <= 0 && !l.reading {
+		return 0, errTimeout
+	}
+	if l.runes == nil {
+		l.want = make(chan struct{})
+		l.runes = make(chan runeResult, 1)
+		go l.readInput()
+	}
+	if !l.reading {
+		// only ask for one rune at a time so that we don't take input
+		// meant for someone else after Read returns
+		l.want <- struct{}{}
+		l.reading = true
+	}
+	var timeout <-chan time.Time
+	var refresh chan struct{}
+	var winch chan os.Signal
+	switch {
+	case block:
+		if !l.hold {
+			refresh, winch = l.refresh, l.winch
+		}
+	case l.keyTimer != nil:
+		timeout = l.keyTimer(l.KeyTimeout)
+	default:
+		t := time.NewTimer(l.KeyTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case res := <-l.runes:
+		l.reading = false
+		return res.r, res.err
+	case <-timeout:
+		return 0, errTimeout
+	case <-refresh:
+		return 0, errRefresh
+	case <-winch:
+		return 0, errResize
+	}
+}
+
+// read a key, taking any pushed back keys first. If block isn't set, give up
+// and return errTimeout if nothing arrives within KeyTimeout. While
+// waiting, redraw the line whenever Refresh asks or the terminal's resized.
+func (l *LineReader) readKey(block bool) (Key, error) {
+	if len(l.pending) > 0 {
+		k := l.pending[0]
+		l.pending = l.pending[1:]
+		l.recordKey(k)
+		return k, nil
+	}
+	for {
+		k, err := decodeKey(func(first bool) (rune, error) {
+			return l.readRune(first && block)
+		})
+		if err == errRefresh {
+			l.refreshLine()
+			continue
+		}
+		if err == errResize {
+			l.resize()
+			continue
+		}
+		if err == nil {
+			l.recordKey(k)
+		}
+		return k, err
+	}
+}
+
+// push k back so that it's the next key read
+func (l *lineReader) unreadKey(k Key) {
+	if n := len(l.vi.keys); l.vi.recording && n > 0 {
+		l.vi.keys = l.vi.keys[:n-1]
+	}
+	l.pending = append([]Key{k}, l.pending...)
+}
+
+// remember k as part of a vi change if one's being recorded
+func (l *lineReader) recordKey(k Key) {
+	if l.vi.recording {
+		l.vi.keys = append(l.vi.keys, k)
+	}
+}
@@ -0,0 +1,398 @@
+package fineline
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how deeply $include can nest, so that a file including itself stops
+const maxInclude = 10
+
+// the state of reading an inputrc file
+type inputrc struct {
+	l *LineReader
+	// the keymap that bindings go into, as chosen by set keymap
+	keys *keymap
+	// for each $if we're inside, whether its current branch applies
+	conds []bool
+	// the first error, if any
+	err error
+}
+
+// LoadInputrc reads the user's readline init file, as GNU readline does at
+// startup: the file named by $INPUTRC, or else ~/.inputrc, or else
+// /etc/inputrc. It's not an error if there's no such file.
+// NewLineReader calls this itself.
+func (l *LineReader) LoadInputrc() error {
+	name := os.Getenv("INPUTRC")
+	if name == "" {
+		name = filepath.Join(getHome(), ".inputrc")
+		if _, err := os.Stat(name); err != nil {
+			name = "/etc/inputrc"
+		}
+	}
+	err := l.readInputrcFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ReadInputrc reads readline init commands in the inputrc format from r
+// and applies them to l: set commands change the settings fineline knows,
+// such as editing-mode, keyseq-timeout and completion-query-items, and key
+// bindings are made with Bind. $if, $else, $endif and $include work as in
+// readline; $if tests mode=, term= against $TERM, or Name.
+// Lines fineline can't use are skipped, and the first problem is returned
+// after the rest have been applied.
+func (l *LineReader) ReadInputrc(r io.Reader) error {
+	p := inputrc{l: l, keys: l.keymap()}
+	p.read(r, "inputrc", 0)
+	return p.err
+}
+
+func (l *LineReader) readInputrcFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p := inputrc{l: l, keys: l.keymap()}
+	p.read(f, name, 0)
+	return p.err
+}
+
+func (p *inputrc) read(r io.Reader, name string, depth int) {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		if err := p.line(strings.TrimSpace(s.Text()), depth); err != nil && p.err == nil {
+			p.err = fmt.Errorf("fineline: %s:%d: %v", name, n, err)
+		}
+	}
+	if err := s.Err(); err != nil && p.err == nil {
+		p.err = err
+	}
+}
+
+// whether lines apply, given the $ifs we're in
+func (p *inputrc) active() bool {
+	for _, c := range p.conds {
+		if !c {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *inputrc) line(line string, depth int) error {
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+	if line[0] == '$' {
+		return p.directive(line[1:], depth)
+	}
+	if !p.active() {
+		return nil
+	}
+	if strings.HasPrefix(line, "set") && len(line) > 3 && (line[3] == ' ' || line[3] == '\t') {
+		f := strings.Fields(line[4:])
+		if len(f) < 2 {
+			return errors.New("set needs a variable and a value")
+		}
+		return p.set(f[0], f[1])
+	}
+	return p.bind(line)
+}
+
+func (p *inputrc) directive(line string, depth int) error {
+	cmd, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		cmd, arg = line[:i], strings.TrimSpace(line[i:])
+	}
+	switch cmd {
+	case "if":
+		p.conds = append(p.conds, p.test(arg))
+	case "else":
+		if len(p.conds) == 0 {
+			return errors.New("$else without $if")
+		}
+		p.conds[len(p.conds)-1] = !p.conds[len(p.conds)-1]
+	case "endif":
+		if len(p.conds) == 0 {
+			return errors.New("$endif without $if")
+		}
+		p.conds = p.conds[:len(p.conds)-1]
+	case "include":
+		if !p.active() {
+			return nil
+		}
+		if depth >= maxInclude {
+			return errors.New("$include nested too deeply")
+		}
+		if strings.HasPrefix(arg, "~/") {
+			arg = filepath.Join(getHome(), arg[2:])
+		}
+		f, err := os.Open(arg)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		p.read(f, arg, depth+1)
+	default:
+		return errors.New("unknown directive $" + cmd)
+	}
+	return nil
+}
+
+// the condition of an $if
+func (p *inputrc) test(cond string) bool {
+	switch {
+	case strings.HasPrefix(cond, "mode="):
+		mode := cond[len("mode="):]
+		if p.l.mode == EmacsMode {
+			return mode == "emacs"
+		}
+		return mode == "vi"
+	case strings.HasPrefix(cond, "term="):
+		term, want := os.Getenv("TERM"), cond[len("term="):]
+		if i := strings.IndexByte(term, '-'); i >= 0 && strings.EqualFold(term[:i], want) {
+			return true
+		}
+		return strings.EqualFold(term, want)
+	}
+	return p.l.Name != "" && strings.EqualFold(cond, p.l.Name)
+}
+
+func (p *inputrc) set(name, value string) error {
+	switch strings.ToLower(name) {
+	case "editing-mode":
+		switch value {
+		case "emacs":
+			p.l.SetEditMode(EmacsMode)
+		case "vi":
+			p.l.SetEditMode(ViInsertMode)
+		default:
+			return errors.New("unknown editing mode " + value)
+		}
+		p.keys = p.l.keymap()
+	case "keymap":
+		switch value {
+		case "emacs", "emacs-standard":
+			p.keys = p.l.keymaps[EmacsMode]
+		case "vi", "vi-move", "vi-command":
+			p.keys = p.l.keymaps[ViCommandMode]
+		case "vi-insert":
+			p.keys = p.l.keymaps[ViInsertMode]
+		default:
+			return errors.New("unknown keymap " + value)
+		}
+	case "completion-query-items":
+		if n, err := strconv.Atoi(value); err == nil {
+			p.l.CompletionQueryItems = n
+		}
+	case "keyseq-timeout":
+		// readline waits forever if this isn't positive, which we can't
+		ms, err := strconv.Atoi(value)
+		if err == nil && ms > 0 {
+			p.l.KeyTimeout = time.Duration(ms) * time.Millisecond
+		}
+	}
+	// anything else is a readline setting that doesn't apply to us
+	return nil
+}
+
+// a binding like "\C-x\C-r": re-read-init-file, Meta-Rubout:
+// backward-kill-word or "\ep": "\C-a\C-k"
+func (p *inputrc) bind(line string) error {
+	var seq, rest string
+	var err error
+	if line[0] == '"' {
+		var quoted string
+		quoted, rest = splitQuoted(line)
+		seq = unescapeInputrc(quoted)
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, ":") {
+			return errors.New("expected : after key sequence")
+		}
+		rest = rest[1:]
+	} else {
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return errors.New("expected a key binding")
+		}
+		if seq, err = parseKeyName(strings.TrimSpace(line[:i])); err != nil {
+			return err
+		}
+		rest = line[i+1:]
+	}
+	if seq == "" {
+		return errEmptySeq
+	}
+	rest = strings.TrimSpace(rest)
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		quoted, _ := splitQuoted(rest)
+		keys := parseKeys(unescapeInputrc(quoted))
+		p.keys.bind(seq, binding{op: noop, fn: func(l *LineReader) {
+			l.pending = append(append([]Key(nil), keys...), l.pending...)
+		}})
+		return nil
+	}
+	command := rest
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		command = rest[:i]
+	}
+	op, ok := opNames[strings.ToLower(command)]
+	if !ok {
+		return errors.New("unknown command " + command)
+	}
+	p.keys.bind(seq, binding{op: op})
+	return nil
+}
+
+// split s, which starts with a quote, into what's inside the quotes and
+// what follows the closing one
+func splitQuoted(s string) (quoted, rest string) {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case q:
+			return s[1:i], s[i+1:]
+		}
+	}
+	return s[1:], ""
+}
+
+// the names readline gives keys in bindings like Control-u or Meta-Rubout
+var inputrcKeyNames = map[string]string{
+	"del":     "\x7f",
+	"esc":     "\x1b",
+	"escape":  "\x1b",
+	"lfd":     "\n",
+	"newline": "\n",
+	"ret":     "\r",
+	"return":  "\r",
+	"rubout":  "\x7f",
+	"space":   " ",
+	"spc":     " ",
+	"tab":     "\t",
+}
+
+// the raw input for a key name such as Control-u, C-M-f or TAB
+func parseKeyName(name string) (string, error) {
+	var ctrl, meta bool
+	for {
+		lower := strings.ToLower(name)
+		switch {
+		case strings.HasPrefix(lower, "control-"):
+			ctrl, name = true, name[len("control-"):]
+		case strings.HasPrefix(lower, "c-"):
+			ctrl, name = true, name[len("c-"):]
+		case strings.HasPrefix(lower, "meta-"):
+			meta, name = true, name[len("meta-"):]
+		case strings.HasPrefix(lower, "m-"):
+			meta, name = true, name[len("m-"):]
+		default:
+			s, ok := inputrcKeyNames[lower]
+			if !ok {
+				r := []rune(name)
+				if len(r) != 1 {
+					return "", errors.New("unknown key name " + name)
+				}
+				s = name
+			}
+			return modifyKey(s, ctrl, meta), nil
+		}
+	}
+}
+
+// s with ctrl and meta applied to its first character; meta is sent as a
+// preceding escape
+func modifyKey(s string, ctrl, meta bool) string {
+	if ctrl && s != "" && s[0] < 0x80 {
+		s = string(controlChar(s[0])) + s[1:]
+	}
+	if meta {
+		s = "\x1b" + s
+	}
+	return s
+}
+
+func controlChar(c byte) byte {
+	if c == '?' {
+		return 0x7f
+	}
+	return c & 0x1f
+}
+
+// the raw input for a quoted key sequence or macro, with readline's escapes
+// like \C-a, \M-f, \e and \t replaced
+func unescapeInputrc(s string) string {
+	var b bytes.Buffer
+	var ctrl, meta bool
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			if rest := s[i+1:]; strings.HasPrefix(rest, "C-") {
+				ctrl = true
+				i += 2
+				continue
+			} else if strings.HasPrefix(rest, "M-") {
+				meta = true
+				i += 2
+				continue
+			}
+			i++
+			switch c = s[i]; c {
+			case 'a':
+				c = '\a'
+			case 'b':
+				c = '\b'
+			case 'd':
+				c = 0x7f
+			case 'e':
+				c = 0x1b
+			case 'f':
+				c = '\f'
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'v':
+				c = '\v'
+			case 'x':
+				n := 0
+				for n < 2 && i+1+n < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[i+1+n]) >= 0 {
+					n++
+				}
+				if n > 0 {
+					v, _ := strconv.ParseUint(s[i+1:i+1+n], 16, 8)
+					c = byte(v)
+					i += n
+				}
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n := 1
+				for n < 3 && i+n < len(s) && '0' <= s[i+n] && s[i+n] <= '7' {
+					n++
+				}
+				v, _ := strconv.ParseUint(s[i:i+n], 8, 8)
+				c = byte(v)
+				i += n - 1
+			}
+		}
+		b.WriteString(modifyKey(string([]byte{c}), ctrl, meta))
+		ctrl, meta = false, false
+	}
+	return b.String()
+}
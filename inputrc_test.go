@@ -0,0 +1,185 @@
+package fineline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnescapeInputrc(t *testing.T) {
+	for _, test := range []struct{ in, expected string }{
+		{`abc`, "abc"},
+		{`\C-a\C-k`, "\x01\x0b"},
+		{`\M-f`, "\x1bf"},
+		{`\M-\C-h`, "\x1b\x08"},
+		{`\C-?`, "\x7f"},
+		{`\e[A\t\n\r\d\\\"\'`, "\x1b[A\t\n\r\x7f\\\"'"},
+		{`\101\x41\x4a`, "AAJ"},
+	} {
+		if s := unescapeInputrc(test.in); s != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.in, test.expected, s)
+		}
+	}
+}
+
+func TestParseKeyName(t *testing.T) {
+	for _, test := range []struct{ in, expected string }{
+		{"Control-u", "\x15"},
+		{"C-w", "\x17"},
+		{"Meta-Rubout", "\x1b\x7f"},
+		{"M-DEL", "\x1b\x7f"},
+		{"TAB", "\t"},
+		{"ESC", "\x1b"},
+		{"a", "a"},
+		{"Meta-Control-h", "\x1b\x08"},
+	} {
+		if s, err := parseKeyName(test.in); err != nil || s != test.expected {
+			t.Errorf("%s: expected %q, got %q, %v", test.in, test.expected, s, err)
+		}
+	}
+	if _, err := parseKeyName("Control-nothing"); err == nil {
+		t.Error("expected an error for an unknown key name")
+	}
+}
+
+func TestReadInputrc(t *testing.T) {
+	l, _ := newTestReader("ab\x15c\x18\x01!\x1bpd\r")
+	err := l.ReadInputrc(strings.NewReader(`
+# comments and blank lines are ignored
+
+Control-u: beginning-of-line
+"\C-x\C-a": end-of-line
+"\ep": "\C-axy"
+set keyseq-timeout 250
+set completion-query-items 50
+set bell-style none
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := l.getLine(); line != "xydcab!\n" {
+		t.Errorf("expected %q, got %q", "xydcab!\n", line)
+	}
+	if l.KeyTimeout != 250*time.Millisecond {
+		t.Errorf("expected a key timeout of 250ms, got %v", l.KeyTimeout)
+	}
+	if l.CompletionQueryItems != 50 {
+		t.Errorf("expected to ask about 50 candidates, got %d", l.CompletionQueryItems)
+	}
+}
+
+func TestInputrcErrors(t *testing.T) {
+	l, _ := newTestReader("\x01\x02x\r")
+	err := l.ReadInputrc(strings.NewReader(`"\C-a": no-such-command
+"\C-b": beginning-of-line
+`))
+	if err == nil || !strings.Contains(err.Error(), "inputrc:1:") {
+		t.Errorf("expected an error on line 1, got %v", err)
+	}
+	// the good lines still apply
+	if line, _ := l.getLine(); line != "x\n" {
+		t.Errorf("expected %q, got %q", "x\n", line)
+	}
+}
+
+func TestInputrcConditionals(t *testing.T) {
+	defer os.Setenv("TERM", os.Getenv("TERM"))
+	os.Setenv("TERM", "xterm-256color")
+	l, _ := newTestReader("")
+	l.Name = "Test"
+	err := l.ReadInputrc(strings.NewReader(`
+$if term=xterm
+"a": beginning-of-line
+$else
+"a": end-of-line
+$endif
+$if term=rxvt
+"b": beginning-of-line
+$else
+"b": end-of-line
+$endif
+$if mode=emacs
+set editing-mode vi
+$if mode=vi
+"c": beginning-of-line
+$endif
+$endif
+$if test
+"d": beginning-of-line
+$if Other
+"d": end-of-line
+$endif
+$endif
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Mode() != ViInsertMode {
+		t.Errorf("expected vi mode, got %v", l.Mode())
+	}
+	for _, test := range []struct {
+		mode EditMode
+		seq  string
+		op   int
+	}{
+		{EmacsMode, "a", opHome},
+		{EmacsMode, "b", opEnd},
+		{ViInsertMode, "c", opHome},
+		{ViInsertMode, "d", opHome},
+	} {
+		m := l.keymaps[test.mode].next[Key{Code: rune(test.seq[0])}]
+		if m == nil || !m.bound || m.op != test.op {
+			t.Errorf("%q: expected op %d, got %+v", test.seq, test.op, m)
+		}
+	}
+}
+
+func TestInputrcKeymaps(t *testing.T) {
+	l, _ := newTestReader("")
+	err := l.ReadInputrc(strings.NewReader(`
+set keymap vi-command
+"Q": end-of-line
+set keymap vi-insert
+"\C-a": beginning-of-line
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Mode() != EmacsMode {
+		t.Errorf("set keymap changed the editing mode to %v", l.Mode())
+	}
+	if m := l.keymaps[ViCommandMode].next[Key{Code: 'Q'}]; m == nil || m.op != opEnd {
+		t.Error("expected Q bound in vi command mode")
+	}
+	if m := l.keymaps[ViInsertMode].next[Key{Code: 1}]; m == nil || m.op != opHome {
+		t.Error("expected ctrl-a bound in vi insert mode")
+	}
+}
+
+func TestLoadInputrc(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "inputrc")
+	included := filepath.Join(dir, "included")
+	if err := os.WriteFile(name, []byte("$include "+included+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(included, []byte("set editing-mode vi\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("INPUTRC", os.Getenv("INPUTRC"))
+	os.Setenv("INPUTRC", name)
+	l, _ := newTestReader("")
+	if err := l.LoadInputrc(); err != nil {
+		t.Fatal(err)
+	}
+	if l.Mode() != ViInsertMode {
+		t.Errorf("expected vi mode, got %v", l.Mode())
+	}
+
+	os.Setenv("INPUTRC", filepath.Join(dir, "missing"))
+	if err := l.LoadInputrc(); err != nil {
+		t.Errorf("expected a missing inputrc to be ignored, got %v", err)
+	}
+}
@@ -5,12 +5,18 @@ import (
 	"unsafe"
 )
 
-func winIoctl(fd int, cmd uintptr, win *winsize) {
-	_, _, _ = syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), cmd, uintptr(unsafe.Pointer(win)))
-	return
+func winIoctl(fd int, cmd uintptr, win *winsize) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), cmd, uintptr(unsafe.Pointer(win)))
+	if e != 0 {
+		return e
+	}
+	return nil
 }
 
-func ttyIoctl(fd int, cmd uintptr, term *termios) {
-	_, _, _ = syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), cmd, uintptr(unsafe.Pointer(term)))
-	return
+func ttyIoctl(fd int, cmd uintptr, term *termios) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), cmd, uintptr(unsafe.Pointer(term)))
+	if e != 0 {
+		return e
+	}
+	return nil
 }
@@ -0,0 +1,219 @@
+package fineline
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// what a key sequence does: either a built-in op or a user's function
+type binding struct {
+	op int
+	fn func(*LineReader)
+}
+
+// A keymap maps key sequences to bindings. It's a trie with a key at each
+// level.
+type keymap struct {
+	bound bool
+	binding
+	next map[Key]*keymap
+}
+
+// the names of the built-in ops, as GNU readline calls them
+var opNames = map[string]int{
+	"self-insert":            opPutc,
+	"backward-delete-char":   opBackspace,
+	"delete-char":            opDelete,
+	"unix-line-discard":      opDeleteToBeginning,
+	"kill-line":              opDeleteToEnd,
+	"clear-screen":           opClear,
+	"beginning-of-line":      opHome,
+	"end-of-line":            opEnd,
+	"forward-char":           opRight,
+	"backward-char":          opLeft,
+	"previous-history":       opUp,
+	"next-history":           opDown,
+	"complete":               opComplete,
+	"cancel-line":            opCancel,
+	"end-of-file":            opEof,
+	"accept-line":            opSubmit,
+	"transpose-chars":        opTranspose,
+	"abort":                  opAbort,
+	"reverse-search-history": opSearchBackward,
+	"forward-search-history": opSearchForward,
+	"yank":                   opYank,
+	"yank-pop":               opYankPop,
+	"undo":                   opUndo,
+	"redo":                   opRedo,
+	"forward-word":           opForwardWord,
+	"backward-word":          opBackwardWord,
+	"kill-word":              opKillWord,
+	"backward-kill-word":     opBackwardKillWord,
+	"unix-word-rubout":       opUnixWordRubout,
+	"transpose-words":        opTransposeWords,
+	"upcase-word":            opUpcaseWord,
+	"downcase-word":          opDowncaseWord,
+	"capitalize-word":        opCapitalizeWord,
+	"vi-movement-mode":       opViMovementMode,
+	"vi-editing-mode":        opViEditingMode,
+	"emacs-editing-mode":     opEmacsEditingMode,
+	"menu-complete":          opMenuComplete,
+	"menu-complete-backward": opMenuCompleteBackward,
+	"menu-select":            opMenuSelect,
+}
+
+var errEmptySeq = errors.New("fineline: empty key sequence")
+
+func newKeymap(keys []keyBinding) *keymap {
+	m := new(keymap)
+	for _, k := range keys {
+		m.bind(k.seq, binding{op: k.op})
+	}
+	return m
+}
+
+func (m *keymap) bind(seq string, b binding) {
+	for _, k := range parseKeys(seq) {
+		n := m.next[k]
+		if n == nil {
+			if m.next == nil {
+				m.next = make(map[Key]*keymap)
+			}
+			n = new(keymap)
+			m.next[k] = n
+		}
+		m = n
+	}
+	m.bound = true
+	m.binding = b
+}
+
+func (m *keymap) unbind(seq string) {
+	for _, k := range parseKeys(seq) {
+		if m = m.next[k]; m == nil {
+			return
+		}
+	}
+	m.bound = false
+	m.binding = binding{}
+}
+
+// Bind binds the key sequence seq to the named editing command. seq is the
+// raw input the terminal sends, so it can be a chord like "\x18\x05"
+// (ctrl-x ctrl-e) or an escape sequence like "\x1b[A" (up arrow). Escape
+// sequences are decoded into keys, so "\x1bOA" binds the same key as
+// "\x1b[A"; Key.Seq gives a sequence for any key.
+// The command names are GNU readline's, such as "beginning-of-line" or
+// "kill-line".
+// Each editing mode has its own bindings, and Bind changes the current
+// mode's; see SetEditMode.
+func (l *LineReader) Bind(seq, command string) error {
+	op, ok := opNames[command]
+	if !ok {
+		return errors.New("fineline: unknown command " + command)
+	}
+	if seq == "" {
+		return errEmptySeq
+	}
+	l.keymap().bind(seq, binding{op: op})
+	return nil
+}
+
+// BindFunc binds the key sequence seq to f. f is called with the LineReader
+// whenever seq is typed and can use Buffer and SetBuffer to edit the line.
+func (l *LineReader) BindFunc(seq string, f func(l *LineReader)) error {
+	if seq == "" {
+		return errEmptySeq
+	}
+	l.keymap().bind(seq, binding{op: noop, fn: f})
+	return nil
+}
+
+// Unbind removes the binding for the key sequence seq. Keys that aren't
+// bound to anything insert themselves if they're printable and are ignored
+// otherwise.
+func (l *LineReader) Unbind(seq string) {
+	l.keymap().unbind(seq)
+}
+
+// Buffer returns the line being edited and the cursor's byte offset in it.
+func (l *LineReader) Buffer() (line string, pos int) {
+	return l.buf.String(), l.pos
+}
+
+// SetBuffer replaces the line being edited and moves the cursor to pos.
+func (l *LineReader) SetBuffer(line string, pos int) {
+	if pos < 0 || pos > len(line) {
+		pos = len(line)
+	}
+	l.saveUndo()
+	l.buf.reset()
+	l.buf.WriteString(line, 0)
+	l.pos = pos
+	l.refreshLine()
+}
+
+// the bindings for the current editing mode
+func (l *lineReader) keymap() *keymap {
+	return l.keymaps[l.mode]
+}
+
+// read keys until they make up a sequence bound in root, returning its
+// binding and the last key read
+func (l *LineReader) readBinding(root *keymap) (binding, Key, error) {
+	m := root
+	var last Key
+	for {
+		// if the keys so far are bound but could also go on to make a
+		// longer sequence, only wait a little while for the rest
+		k, err := l.readKey(m == root || !m.bound)
+		if err == errTimeout {
+			return m.binding, last, nil
+		} else if err != nil {
+			return binding{}, k, err
+		}
+		next := m.next[k]
+		if next == nil {
+			switch {
+			case m == root && k.Mod == 0 && isPrintable(k.Code):
+				return binding{op: opPutc}, k, nil
+			case m == root && k.Mod&ModAlt != 0 && l.mode == ViInsertMode:
+				// vi users type escape and a command quicker than
+				// KeyTimeout, so this is escape followed by a key
+				if esc := root.next[Key{Code: 0x1b}]; esc != nil && esc.bound {
+					l.unreadKey(Key{k.Code, k.Mod &^ ModAlt})
+					l.recordKey(Key{Code: 0x1b})
+					return esc.binding, Key{Code: 0x1b}, nil
+				}
+			case m != root && m.bound:
+				// the keys so far were a sequence of their own
+				l.unreadKey(k)
+				return m.binding, last, nil
+			}
+			return binding{op: noop}, k, nil
+		}
+		m, last = next, k
+		if m.next == nil {
+			if !m.bound {
+				return binding{op: noop}, k, nil
+			}
+			return m.binding, k, nil
+		}
+	}
+}
+
+func isPrintable(c rune) bool {
+	return c >= ' ' && c != 0x7f && c != utf8.RuneError && c < KeyUnknown
+}
+
+// run whatever b is bound to
+func (l *LineReader) run(b binding, k Key) (bool, error) {
+	l.lastOp, l.op = l.op, b.op
+	l.changed = false
+	if b.fn != nil {
+		l.display = false
+		b.fn(l)
+		return true, nil
+	}
+	return l.exec(b.op, k.Code)
+}
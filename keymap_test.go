@@ -0,0 +1,62 @@
+package fineline
+
+import (
+	"testing"
+)
+
+func TestBind(t *testing.T) {
+	l1, _ := newTestReader("ab\x18\x05c\x01\r")
+	l2, _ := newTestReader("ab\x18\x05c\x01\r")
+	if err := l1.Bind("\x18\x05", "beginning-of-line"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l1.Bind("\x01", "end-of-line"); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		l        *LineReader
+		expected string
+	}{
+		{l1, "cab\n"},
+		{l2, "abc\n"},
+	} {
+		line, err := test.l.getLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, line)
+		}
+	}
+	if err := l1.Bind("\x01", "no-such-command"); err == nil {
+		t.Error("expected an error binding an unknown command")
+	}
+}
+
+func TestBindFunc(t *testing.T) {
+	l, _ := newTestReader("abc\x02\x1b[15~\x1b[D!\r")
+	l.BindFunc("\x1b[15~", func(l *LineReader) {
+		line, pos := l.Buffer()
+		l.SetBuffer(line[:pos]+"<F5>"+line[pos:], pos)
+	})
+	line, err := l.getLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "a!b<F5>c\n" {
+		t.Errorf("expected %q, got %q", "a!b<F5>c\n", line)
+	}
+}
+
+func TestUnbind(t *testing.T) {
+	l, _ := newTestReader("ab\x01\x1b[Dc\r")
+	l.Unbind("\x01")
+	l.Unbind("\x1b[D")
+	line, err := l.getLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "abc\n" {
+		t.Errorf("expected %q, got %q", "abc\n", line)
+	}
+}
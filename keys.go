@@ -0,0 +1,405 @@
+package fineline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Key is a single keypress, decoded from what the terminal sends.
+type Key struct {
+	// Code is the character typed, including control characters like
+	// '\x01' for ctrl-a, or one of the Key constants for keys that don't
+	// type a character.
+	Code rune
+	Mod  Mod
+}
+
+// A Mod is a set of modifier keys held down with a key.
+type Mod uint8
+
+// The bits are the ones xterm encodes in its escape sequences.
+const (
+	ModShift Mod = 1 << iota
+	ModAlt
+	ModCtrl
+	ModMeta
+)
+
+// Codes for keys that don't type a character. Function keys past F12 are
+// KeyF1+n-1 for Fn, up to F20.
+const (
+	KeyUnknown rune = unicode.MaxRune + 1 + iota
+	KeyUp
+	KeyDown
+	KeyRight
+	KeyLeft
+	KeyHome
+	KeyEnd
+	KeyBegin
+	KeyInsert
+	KeyDelete
+	KeyPageUp
+	KeyPageDown
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+)
+
+// returned when reading a key takes longer than KeyTimeout
+var errTimeout = errors.New("fineline: timed out")
+
+// final characters of CSI and SS3 sequences for cursor keys
+var cursorKeys = map[rune]rune{
+	'A': KeyUp,
+	'B': KeyDown,
+	'C': KeyRight,
+	'D': KeyLeft,
+	'E': KeyBegin,
+	'F': KeyEnd,
+	'H': KeyHome,
+	'P': KeyF1,
+	'Q': KeyF2,
+	'R': KeyF3,
+	'S': KeyF4,
+}
+
+// the numbers in sequences like ESC[3~
+var tildeKeys = map[int]rune{
+	1:  KeyHome,
+	2:  KeyInsert,
+	3:  KeyDelete,
+	4:  KeyEnd,
+	5:  KeyPageUp,
+	6:  KeyPageDown,
+	7:  KeyHome,
+	8:  KeyEnd,
+	11: KeyF1,
+	12: KeyF2,
+	13: KeyF3,
+	14: KeyF4,
+	15: KeyF5,
+	17: KeyF6,
+	18: KeyF7,
+	19: KeyF8,
+	20: KeyF9,
+	21: KeyF10,
+	23: KeyF11,
+	24: KeyF12,
+	25: KeyF12 + 1,
+	26: KeyF12 + 2,
+	28: KeyF12 + 3,
+	29: KeyF12 + 4,
+	31: KeyF12 + 5,
+	32: KeyF12 + 6,
+	33: KeyF12 + 7,
+	34: KeyF12 + 8,
+}
+
+// the keys on the keypad in application mode, which sends ESC O and a letter
+const keypadKeys = "jklmnopqrstuvwxyX"
+const keypadChars = "*+,-./0123456789="
+
+// decodeKey reads a key using read, which returns the next rune of input.
+// read is called with true for the first rune of a key and false for any
+// after that; with false, it should return errTimeout if the rune doesn't
+// arrive promptly, which tells a lone escape from the start of a sequence.
+func decodeKey(read func(first bool) (rune, error)) (Key, error) {
+	c, err := read(true)
+	if err != nil || c != 0x1b {
+		return Key{Code: c}, err
+	}
+	return decodeEscape(read)
+}
+
+// decode what follows an escape
+func decodeEscape(read func(bool) (rune, error)) (Key, error) {
+	c, err := read(false)
+	if err == errTimeout {
+		return Key{Code: 0x1b}, nil
+	} else if err != nil {
+		return Key{}, err
+	}
+	var k Key
+	switch c {
+	case '[':
+		k, err = decodeCSI(read)
+	case 'O':
+		k, err = decodeSS3(read)
+	case 0x1b:
+		// some terminals send alt-up as escape and then up
+		k, err = decodeEscape(read)
+		k.Mod |= ModAlt
+	default:
+		k = Key{c, ModAlt}
+	}
+	if err == errTimeout {
+		// the sequence was cut short; there's no telling what it was
+		return Key{Code: KeyUnknown}, nil
+	}
+	return k, err
+}
+
+// decode a control sequence: ESC [, then parameters, then a final character
+func decodeCSI(read func(bool) (rune, error)) (Key, error) {
+	c, err := read(false)
+	if err != nil {
+		if err == errTimeout {
+			// alt-[
+			return Key{'[', ModAlt}, nil
+		}
+		return Key{}, err
+	}
+	if c == '[' {
+		// the Linux console sends ESC [ [ A for F1 and so on
+		c, err = read(false)
+		if err != nil {
+			return Key{}, err
+		}
+		if 'A' <= c && c <= 'E' {
+			return Key{Code: KeyF1 + c - 'A'}, nil
+		}
+		return Key{Code: KeyUnknown}, nil
+	}
+	var params []rune
+	for 0x30 <= c && c <= 0x3f {
+		params = append(params, c)
+		if c, err = read(false); err != nil {
+			return Key{}, err
+		}
+	}
+	// rxvt ends shifted keys with $, which is otherwise an intermediate
+	for 0x20 <= c && c <= 0x2f && c != '$' {
+		if c, err = read(false); err != nil {
+			return Key{}, err
+		}
+	}
+	if len(params) > 0 && params[0] >= '<' {
+		// private parameters, as in mouse reports
+		return Key{Code: KeyUnknown}, nil
+	}
+	nums := parseParams(string(params))
+	mod := Mod(0)
+	if len(nums) > 1 && nums[1] > 1 {
+		mod = Mod(nums[1] - 1)
+	}
+	if code, ok := cursorKeys[c]; ok {
+		return Key{code, mod}, nil
+	}
+	switch c {
+	case 'Z':
+		return Key{'\t', ModShift | mod}, nil
+	case 'a', 'b', 'c', 'd':
+		// rxvt's shifted arrows
+		return Key{cursorKeys[c-'a'+'A'], ModShift}, nil
+	case 'u':
+		// a key and its modifiers, spelled out
+		if len(nums) == 0 {
+			break
+		}
+		return normalizeKey(Key{rune(nums[0]), mod}), nil
+	case '~', '$', '^', '@':
+		if len(nums) == 0 {
+			break
+		}
+		code, ok := tildeKeys[nums[0]]
+		if !ok {
+			break
+		}
+		switch c {
+		case '$':
+			mod = ModShift
+		case '^':
+			mod = ModCtrl
+		case '@':
+			mod = ModCtrl | ModShift
+		}
+		return Key{code, mod}, nil
+	}
+	return Key{Code: KeyUnknown}, nil
+}
+
+// decode a single shift sequence: ESC O and a final character
+func decodeSS3(read func(bool) (rune, error)) (Key, error) {
+	c, err := read(false)
+	if err != nil {
+		if err == errTimeout {
+			// alt-O
+			return Key{'O', ModAlt}, nil
+		}
+		return Key{}, err
+	}
+	// a few terminals put a modifier in here
+	var params []rune
+	for '0' <= c && c <= '9' || c == ';' {
+		params = append(params, c)
+		if c, err = read(false); err != nil {
+			return Key{}, err
+		}
+	}
+	mod := Mod(0)
+	if nums := parseParams(string(params)); len(nums) > 0 && nums[len(nums)-1] > 1 {
+		mod = Mod(nums[len(nums)-1] - 1)
+	}
+	if code, ok := cursorKeys[c]; ok {
+		return Key{code, mod}, nil
+	}
+	if c == 'M' {
+		// keypad enter
+		return Key{'\r', mod}, nil
+	}
+	if 'a' <= c && c <= 'd' {
+		// rxvt's ctrl-arrows
+		return Key{cursorKeys[c-'a'+'A'], ModCtrl}, nil
+	}
+	if i := strings.IndexRune(keypadKeys, c); i >= 0 {
+		return Key{rune(keypadChars[i]), mod}, nil
+	}
+	return Key{Code: KeyUnknown}, nil
+}
+
+// parse numeric parameters separated by semicolons; missing ones are 0
+func parseParams(s string) []int {
+	if s == "" {
+		return nil
+	}
+	fields := strings.Split(s, ";")
+	nums := make([]int, len(fields))
+	for i, f := range fields {
+		// sub-parameters after a colon don't matter to us
+		if j := strings.IndexByte(f, ':'); j >= 0 {
+			f = f[:j]
+		}
+		nums[i], _ = strconv.Atoi(f)
+	}
+	return nums
+}
+
+// turn ctrl and a letter into the control character it types
+func normalizeKey(k Key) Key {
+	if k.Mod&ModCtrl != 0 && k.Code < KeyUnknown {
+		c := unicode.ToLower(k.Code)
+		if 'a' <= c && c <= 'z' || c == '@' || '[' <= c && c <= '_' {
+			k.Code = c & 0x1f
+			k.Mod &^= ModCtrl | ModShift
+		}
+	}
+	return k
+}
+
+// parseKeys decodes a string of raw terminal input into keys.
+func parseKeys(seq string) []Key {
+	var keys []Key
+	for seq != "" {
+		k, _ := decodeKey(func(first bool) (rune, error) {
+			if seq == "" {
+				if first {
+					return 0, io.EOF
+				}
+				return 0, errTimeout
+			}
+			c, n := utf8.DecodeRuneInString(seq)
+			seq = seq[n:]
+			return c, nil
+		})
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Seq returns the input a terminal sends for k, which can be passed to Bind.
+// Keys with modifiers are encoded the way xterm does it.
+func (k Key) Seq() string {
+	k = normalizeKey(k)
+	if k.Code < KeyUnknown {
+		s := string(k.Code)
+		if k.Code == '\t' && k.Mod&ModShift != 0 {
+			return "\x1b[Z"
+		}
+		if k.Mod&ModAlt != 0 {
+			s = "\x1b" + s
+		}
+		return s
+	}
+	mod := ""
+	if k.Mod != 0 {
+		mod = fmt.Sprintf(";%d", k.Mod+1)
+	}
+	for c, code := range cursorKeys {
+		if code == k.Code {
+			if mod == "" && KeyF1 <= code && code <= KeyF4 {
+				return "\x1bO" + string(c)
+			}
+			if mod != "" {
+				mod = "1" + mod
+			}
+			return "\x1b[" + mod + string(c)
+		}
+	}
+	for n, code := range tildeKeys {
+		// 7 and 8 are rxvt's home and end; use the usual ones
+		if code == k.Code && n != 7 && n != 8 {
+			return "\x1b[" + strconv.Itoa(n) + mod + "~"
+		}
+	}
+	return ""
+}
+
+var keyNames = map[rune]string{
+	KeyUnknown:  "Unknown",
+	KeyUp:       "Up",
+	KeyDown:     "Down",
+	KeyRight:    "Right",
+	KeyLeft:     "Left",
+	KeyHome:     "Home",
+	KeyEnd:      "End",
+	KeyBegin:    "Begin",
+	KeyInsert:   "Insert",
+	KeyDelete:   "Delete",
+	KeyPageUp:   "PageUp",
+	KeyPageDown: "PageDown",
+	0x1b:        "Escape",
+	'\t':        "Tab",
+	'\r':        "Enter",
+	0x7f:        "Backspace",
+}
+
+// String returns a description of k, like "Ctrl-Right" or "Alt-f".
+func (k Key) String() string {
+	var s string
+	if k.Mod&ModCtrl != 0 {
+		s += "Ctrl-"
+	}
+	if k.Mod&ModAlt != 0 {
+		s += "Alt-"
+	}
+	if k.Mod&ModShift != 0 {
+		s += "Shift-"
+	}
+	if k.Mod&ModMeta != 0 {
+		s += "Meta-"
+	}
+	if name, ok := keyNames[k.Code]; ok {
+		return s + name
+	}
+	switch {
+	case KeyF1 <= k.Code && k.Code <= KeyF12+8:
+		return s + "F" + strconv.Itoa(int(k.Code-KeyF1+1))
+	case k.Code < ' ':
+		return s + "Ctrl-" + string(k.Code+'@')
+	}
+	return s + string(k.Code)
+}
@@ -0,0 +1,137 @@
+package fineline
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+var keyTests = []struct {
+	seq  string
+	keys []Key
+}{
+	{"a", []Key{{'a', 0}}},
+	{"\x01", []Key{{1, 0}}},
+	{"\x1b", []Key{{0x1b, 0}}},
+	{"\x1bf", []Key{{'f', ModAlt}}},
+	{"\x1b\x7f", []Key{{0x7f, ModAlt}}},
+	{"\x1b[A", []Key{{KeyUp, 0}}},
+	{"\x1bOA", []Key{{KeyUp, 0}}},
+	{"\x1b[1;5C", []Key{{KeyRight, ModCtrl}}},
+	{"\x1b[1;3D", []Key{{KeyLeft, ModAlt}}},
+	{"\x1b\x1b[A", []Key{{KeyUp, ModAlt}}},
+	{"\x1b[3~", []Key{{KeyDelete, 0}}},
+	{"\x1b[3;2~", []Key{{KeyDelete, ModShift}}},
+	{"\x1b[15~", []Key{{KeyF5, 0}}},
+	{"\x1b[24;5~", []Key{{KeyF12, ModCtrl}}},
+	{"\x1bOP", []Key{{KeyF1, 0}}},
+	{"\x1b[1;2P", []Key{{KeyF1, ModShift}}},
+	{"\x1b[[C", []Key{{KeyF3, 0}}},
+	{"\x1b[Z", []Key{{'\t', ModShift}}},
+	{"\x1b[7~\x1b[8~", []Key{{KeyHome, 0}, {KeyEnd, 0}}},
+	{"\x1b[3^", []Key{{KeyDelete, ModCtrl}}},
+	{"\x1bOc", []Key{{KeyRight, ModCtrl}}},
+	{"\x1bOM", []Key{{'\r', 0}}},
+	{"\x1b[97;5u", []Key{{1, 0}}},
+	{"\x1b[<0;3;4M", []Key{{KeyUnknown, 0}}},
+	{"\x1b[1;5Cx", []Key{{KeyRight, ModCtrl}, {'x', 0}}},
+	{"\x1b[99xy", []Key{{KeyUnknown, 0}, {'y', 0}}},
+	{"\x18\x05", []Key{{0x18, 0}, {5, 0}}},
+	{"é", []Key{{'é', 0}}},
+}
+
+func keysEqual(x, y []Key) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseKeys(t *testing.T) {
+	for _, test := range keyTests {
+		keys := parseKeys(test.seq)
+		if !keysEqual(keys, test.keys) {
+			t.Errorf("%q: expected %v, got %v", test.seq, test.keys, keys)
+		}
+	}
+}
+
+func TestKeySeq(t *testing.T) {
+	for _, k := range []Key{
+		{'a', 0}, {'f', ModAlt}, {'\t', ModShift}, {KeyUp, 0}, {KeyRight, ModCtrl},
+		{KeyF1, 0}, {KeyF4, ModAlt}, {KeyF5, 0}, {KeyF12 + 8, ModShift},
+		{KeyDelete, ModCtrl | ModShift}, {KeyPageDown, 0}, {KeyHome, 0},
+	} {
+		keys := parseKeys(k.Seq())
+		if len(keys) != 1 || keys[0] != k {
+			t.Errorf("%v: %q decodes to %v", k, k.Seq(), keys)
+		}
+	}
+}
+
+func TestUnboundEscapesDontDesync(t *testing.T) {
+	l, _ := newTestReader("ab\x1b[1;6Dc\x1b[15~d\x1b[5~\r")
+	line, err := l.getLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "abcd\n" {
+		t.Errorf("expected %q, got %q", "abcd\n", line)
+	}
+}
+
+func TestLoneEscape(t *testing.T) {
+	r, w := io.Pipe()
+	l, _ := newTestReader("")
+	l.input.Reset(r)
+	timeouts := make(chan time.Time)
+	l.keyTimer = func(time.Duration) <-chan time.Time {
+		return timeouts
+	}
+	l.SetMaxHistory(10)
+	l.AddHistory("food")
+	go func() {
+		io.WriteString(w, "x\x12fo\x1b")
+		// nothing follows the escape in time
+		timeouts <- time.Time{}
+		io.WriteString(w, "\x1b[D!\r")
+	}()
+	line, err := l.getLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "!x\n" {
+		t.Errorf("expected %q, got %q", "!x\n", line)
+	}
+}
+
+func TestClose(t *testing.T) {
+	r, w := io.Pipe()
+	l, _ := newTestReader("")
+	l.input.Reset(r)
+	go io.WriteString(w, "a\r")
+	if line, err := l.getLine(); err != nil || line != "a\n" {
+		t.Fatalf("expected %q, got %q, %v", "a\n", line, err)
+	}
+	l.Close()
+	// the background reader isn't in the middle of a read, so it stops
+	// straight away
+	select {
+	case _, ok := <-l.want:
+		if ok {
+			t.Error("expected the reader's channel to be closed")
+		}
+	default:
+		t.Error("expected the reader's channel to be closed")
+	}
+	if _, err := l.getLine(); err != errClosed {
+		t.Errorf("expected %v after Close, got %v", errClosed, err)
+	}
+	l.Close()
+	w.Close()
+}
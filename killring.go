@@ -0,0 +1,138 @@
+package fineline
+
+import (
+	"sync"
+)
+
+// A KillRing holds text that's been killed, by ctrl-k for example, so that it
+// can be yanked back. Each LineReader has its own, which lasts from one Read
+// to the next, but LineReaders can share one with SetKillRing.
+type KillRing struct {
+	mu      sync.Mutex
+	entries []string
+	max     int
+	// the entry the last yank or yank-pop used
+	cur int
+}
+
+// NewKillRing creates a KillRing that holds up to size entries.
+func NewKillRing(size int) *KillRing {
+	if size < 1 {
+		size = 1
+	}
+	return &KillRing{max: size}
+}
+
+// add s as a new entry, dropping the oldest if the ring is full
+func (r *KillRing) add(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.max > 0 && len(r.entries) == r.max {
+		copy(r.entries, r.entries[1:])
+		r.entries = r.entries[:r.max-1]
+	}
+	r.entries = append(r.entries, s)
+	r.cur = len(r.entries) - 1
+}
+
+// add s onto the most recent entry, at the front if prepend is set
+func (r *KillRing) extend(s string, prepend bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(r.entries) - 1
+	switch {
+	case n < 0:
+		r.entries = append(r.entries, s)
+	case prepend:
+		r.entries[n] = s + r.entries[n]
+	default:
+		r.entries[n] += s
+	}
+	r.cur = len(r.entries) - 1
+}
+
+// returns the most recent entry
+func (r *KillRing) top() (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == 0 {
+		return "", false
+	}
+	r.cur = len(r.entries) - 1
+	return r.entries[r.cur], true
+}
+
+// returns the entry before the one last yanked, wrapping around to the most
+// recent one after the oldest
+func (r *KillRing) rotate() (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == 0 {
+		return "", false
+	}
+	r.cur--
+	if r.cur < 0 || r.cur >= len(r.entries) {
+		r.cur = len(r.entries) - 1
+	}
+	return r.entries[r.cur], true
+}
+
+// SetKillRing makes l use r for killing and yanking text.
+func (l *LineReader) SetKillRing(r *KillRing) {
+	l.killRing = r
+}
+
+// save the text from start to end on the kill ring and remove it from the
+// buffer. Successive kills go into the same entry, so killing a word at a
+// time and then yanking brings back all of them.
+func (l *LineReader) kill(start, end int) {
+	if start >= end {
+		return
+	}
+	l.saveUndo()
+	s := string(l.buf.Bytes()[start:end])
+	if isKill(l.lastOp) {
+		l.killRing.extend(s, end <= l.pos)
+	} else {
+		l.killRing.add(s)
+	}
+	l.buf.remove(start, end)
+	if l.pos > start {
+		l.pos = start
+	}
+	l.refreshLine()
+}
+
+func isKill(op int) bool {
+	switch op {
+	case opDeleteToEnd, opDeleteToBeginning, opKillWord, opBackwardKillWord, opUnixWordRubout:
+		return true
+	}
+	return false
+}
+
+// insert the most recently killed text
+func (l *LineReader) yank() {
+	s, ok := l.killRing.top()
+	if !ok {
+		return
+	}
+	l.yanked = [2]int{l.pos, l.pos + len(s)}
+	l.puts(s)
+}
+
+// replace the text just yanked with the kill before it
+func (l *LineReader) yankPop() {
+	if l.lastOp != opYank && l.lastOp != opYankPop {
+		return
+	}
+	s, ok := l.killRing.rotate()
+	if !ok {
+		return
+	}
+	l.saveUndo()
+	l.buf.remove(l.yanked[0], l.yanked[1])
+	l.pos = l.yanked[0]
+	l.yanked[1] = l.pos + len(s)
+	l.puts(s)
+}
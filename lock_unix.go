@@ -0,0 +1,17 @@
+// +build darwin freebsd linux netbsd openbsd
+
+package fineline
+
+import (
+	"os"
+	"syscall"
+)
+
+// take an exclusive advisory lock on f, waiting for other holders to let go
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
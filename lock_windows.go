@@ -0,0 +1,34 @@
+package fineline
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procLockFileEx   = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+	procUnlockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("UnlockFileEx")
+)
+
+const _LOCKFILE_EXCLUSIVE_LOCK = 0x2
+
+// take an exclusive lock on f, waiting for other holders to let go
+func lockFile(f *os.File) error {
+	var ol syscall.Overlapped
+	ok, _, e := procLockFileEx.Call(f.Fd(), _LOCKFILE_EXCLUSIVE_LOCK, 0,
+		1, 0, uintptr(unsafe.Pointer(&ol)))
+	if ok == 0 {
+		return os.NewSyscallError("LockFileEx", e)
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	var ol syscall.Overlapped
+	ok, _, e := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if ok == 0 {
+		return os.NewSyscallError("UnlockFileEx", e)
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package fineline
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// the most rows of candidates shown under the line at once
+const maxMenuRows = 10
+
+// how the candidates are shown under the line while one's being chosen
+const (
+	noMenu = iota
+	// in columns, for menu-complete
+	menuGrid
+	// one to a row under the word being completed, for menu-select
+	menuList
+)
+
+// complete the line by putting each candidate into it in turn, like
+// readline's menu-complete: menu-complete, or complete, and
+// menu-complete-backward go on to the next or previous candidate, and abort
+// puts back what was there before, as does escape in vi's insert mode. The
+// candidates are shown under the line with the one in it highlighted. Any
+// other key leaves the line as it is and is then executed as usual.
+func (l *LineReader) menuComplete(reverse bool) (bool, error) {
+	str := l.buf.String()
+	candidates := l.c.Candidates(str[:l.pos], str[l.pos:])
+	switch {
+	case len(candidates) == 0 || !candidatesFit(candidates, str):
+		return true, nil
+	case len(candidates) == 1:
+		c := candidates[0]
+		l.replace(c.Start, c.End, c.Replacement)
+		return true, nil
+	}
+	origPos := l.pos
+	l.saveUndo()
+	l.candidates, l.menu, l.menuTop = candidates, menuGrid, 0
+	i := 0
+	if reverse {
+		i = len(candidates) - 1
+	}
+	for {
+		c := candidates[i]
+		l.selected = i
+		l.buf.reset()
+		l.buf.WriteString(str[:c.Start]+c.Replacement+str[c.End:], 0)
+		l.pos = c.Start + len(c.Replacement)
+		l.refreshLine()
+		b, k, err := l.readBinding(l.keymap())
+		if err != nil {
+			l.menu = noMenu
+			return false, err
+		}
+		switch b.op {
+		case opComplete, opMenuComplete:
+			i = (i + 1) % len(candidates)
+		case opMenuCompleteBackward:
+			i = (i + len(candidates) - 1) % len(candidates)
+		case opAbort, opViMovementMode:
+			// vi's escape is taken back as well, staying in insert mode
+			l.menu = noMenu
+			l.buf.reset()
+			l.buf.WriteString(str, 0)
+			l.pos = origPos
+			l.refreshLine()
+			return true, nil
+		default:
+			l.menu = noMenu
+			l.refreshLine()
+			return l.run(b, k)
+		}
+	}
+}
+
+// choose a completion from a menu under the word being completed, like zsh's
+// menu-select: up and down, or the commands bound to them, move the
+// selection, page up and page down move it a menu's height, and enter puts
+// it into the line. Typing edits the line as usual, and the menu then shows
+// the candidates for what's there now. Abort, which is escape by default,
+// closes the menu, as does any other key, which is then executed as usual.
+func (l *LineReader) menuSelect() (bool, error) {
+	defer func() {
+		l.menu = noMenu
+	}()
+	query := true
+	for {
+		if query {
+			str := l.buf.String()
+			candidates := l.c.Candidates(str[:l.pos], str[l.pos:])
+			if len(candidates) == 0 || !candidatesFit(candidates, str) {
+				l.menu = noMenu
+				l.refreshLine()
+				return true, nil
+			}
+			l.candidates, l.menu = candidates, menuList
+			l.selected, l.menuTop = 0, 0
+			query = false
+		}
+		n := len(l.candidates)
+		l.refreshLine()
+		b, k, err := l.readBinding(l.keymap())
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case k.Code == KeyPageUp:
+			if l.selected -= l.menuHeight(); l.selected < 0 {
+				l.selected = 0
+			}
+			continue
+		case k.Code == KeyPageDown:
+			if l.selected += l.menuHeight(); l.selected >= n {
+				l.selected = n - 1
+			}
+			continue
+		}
+		switch b.op {
+		case opUp, opMenuCompleteBackward:
+			l.selected = (l.selected + n - 1) % n
+		case opDown, opComplete, opMenuComplete, opMenuSelect:
+			l.selected = (l.selected + 1) % n
+		case opSubmit:
+			c := l.candidates[l.selected]
+			l.menu = noMenu
+			l.replace(c.Start, c.End, c.Replacement)
+			return true, nil
+		case opPutc, opBackspace:
+			// the candidates are for the line as it was, so the menu's
+			// closed while it's edited and opened again for the new one
+			l.menu, l.candidates = noMenu, nil
+			if _, err := l.run(b, k); err != nil {
+				return false, err
+			}
+			query = true
+		case opAbort:
+			l.menu = noMenu
+			l.refreshLine()
+			return true, nil
+		default:
+			l.menu = noMenu
+			l.refreshLine()
+			return l.run(b, k)
+		}
+	}
+}
+
+// reports whether the candidates' ranges are all within str
+func candidatesFit(candidates []Candidate, str string) bool {
+	for _, c := range candidates {
+		if c.Start < 0 || c.Start > c.End || c.End > len(str) {
+			return false
+		}
+	}
+	return true
+}
+
+// write the menu of candidates under the line, starting on the row after
+// the cursor's, or on the cursor's if the line's just filled the one before,
+// and return how many rows down it leaves the cursor
+func (l *LineReader) writeMenu(onNewRow bool) int {
+	rows := l.candidateGrid()
+	for i, row := range rows {
+		if i > 0 || !onNewRow {
+			fmt.Fprint(l.output, "\r\n")
+		} else {
+			fmt.Fprint(l.output, "\r")
+		}
+		fmt.Fprint(l.output, row)
+	}
+	if onNewRow {
+		return len(rows) - 1
+	}
+	return len(rows)
+}
+
+// returns the rows of the menu: the candidates laid out as columns, or as
+// a list under the word being completed, with the selected one highlighted.
+// If there are more rows than menuHeight, the menu scrolls to show the
+// selected one.
+func (l *lineReader) candidateGrid() []string {
+	if !candidatesFit(l.candidates, l.buf.String()) {
+		return nil
+	}
+	cells := l.candidateCells()
+	if len(cells) == 0 {
+		return nil
+	}
+	width, n := l.gridSize(cells)
+	indent := ""
+	if l.menu == menuList {
+		n = len(cells)
+		px, py := l.promptEnd(l.prompt)
+		x, _ := l.advance(l.buf.String()[:l.candidates[0].Start], px, py)
+		if x > l.cols-1-width {
+			x = l.cols - 1 - width
+		}
+		if x > 0 {
+			indent = strings.Repeat(" ", x)
+		}
+	}
+	h := l.menuHeight()
+	sel := l.selected % n
+	if sel < l.menuTop {
+		l.menuTop = sel
+	} else if sel >= l.menuTop+h {
+		l.menuTop = sel - h + 1
+	}
+	var rows []string
+	for r := l.menuTop; r < n && r < l.menuTop+h; r++ {
+		rows = append(rows, indent+gridRow(cells, width, n, r, l.selected))
+	}
+	return rows
+}
+
+// returns how many rows the menu can take: maxMenuRows, or fewer if the
+// terminal hasn't room for them under the line, so that it doesn't scroll
+func (l *lineReader) menuHeight() int {
+	h := maxMenuRows
+	if l.rows > 0 && l.rows-1-l.lines < h {
+		h = l.rows - 1 - l.lines
+	}
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+// returns how wide to make the columns to lay cells out in, and how many
+// rows that takes: as many columns as fit the terminal, two spaces apart,
+// with its last column left empty so it doesn't wrap
+func (l *lineReader) gridSize(cells []string) (width, rows int) {
+	for _, cell := range cells {
+		if w := stringWidth(cell); w > width {
+			width = w
+		}
+	}
+	cols := (l.cols + 1) / (width + 2)
+	if cols < 1 {
+		cols = 1
+	}
+	return width, (len(cells) + cols - 1) / cols
+}
+
+// returns row r of cells laid out in columns width wide, going down each
+// column in turn, with cell selected highlighted
+func gridRow(cells []string, width, rows, r, selected int) string {
+	var b bytes.Buffer
+	for i := r; i < len(cells); i += rows {
+		if i != r {
+			b.WriteString("  ")
+		}
+		cell := cells[i]
+		// the last one in the row only needs padding to highlight it
+		if i+rows < len(cells) || i == selected {
+			cell += strings.Repeat(" ", width-stringWidth(cell))
+		}
+		if i == selected {
+			cell = "\x1b[7m" + cell + "\x1b[0m"
+		}
+		b.WriteString(cell)
+	}
+	return b.String()
+}
+
+// returns how each of the candidates is listed: what's shown for it and
+// then its description, if it has one, with the descriptions lined up
+func (l *lineReader) candidateCells() []string {
+	cells := make([]string, len(l.candidates))
+	width := 0
+	for i, c := range l.candidates {
+		cells[i] = visible(c.display())
+		if w := stringWidth(cells[i]); w > width {
+			width = w
+		}
+	}
+	for i, c := range l.candidates {
+		if c.Description != "" {
+			cells[i] += strings.Repeat(" ", width-stringWidth(cells[i])+2) + visible(c.Description)
+		}
+		cells[i] = truncate(cells[i], l.cols-1)
+	}
+	return cells
+}
+
+// list the candidates from the last completion under the line, in columns
+// like the menu's, and then draw the line again below them. If there are at
+// least CompletionQueryItems, ask first, and if there are more rows than fit
+// the terminal, pause after each screenful as more does.
+func (l *LineReader) printCandidates() {
+	// go below the line, wherever the cursor is in it
+	l.setCursor(0, l.lines-l.y)
+	fmt.Fprint(l.output, "\r\n")
+	defer func() {
+		// the line starts again here
+		l.y = 0
+		l.refreshLine()
+	}()
+	if n := len(l.candidates); l.CompletionQueryItems > 0 && n >= l.CompletionQueryItems {
+		fmt.Fprintf(l.output, "Display all %d possibilities? (y or n)", n)
+		ok := l.yesOrNo()
+		fmt.Fprint(l.output, "\r\n")
+		if !ok {
+			return
+		}
+	}
+	cells := l.candidateCells()
+	width, n := l.gridSize(cells)
+	left := l.rows - 1
+	for r := 0; r < n; r++ {
+		if l.rows > 1 && left == 0 {
+			fmt.Fprint(l.output, "--More--")
+			left = l.more()
+			fmt.Fprint(l.output, "\r\x1b[K")
+			if left == 0 {
+				return
+			}
+		}
+		fmt.Fprint(l.output, gridRow(cells, width, n, r, -1), "\r\n")
+		left--
+	}
+}
+
+// read a key in answer to a question printed under the line. Refresh and
+// resizes wait until it's answered, since drawing the line again would draw
+// over the question.
+func (l *LineReader) readAnswer() (Key, error) {
+	l.hold = true
+	defer func() {
+		l.hold = false
+	}()
+	return l.readKey(true)
+}
+
+// wait for y or n, or space or abort, which mean the same
+func (l *LineReader) yesOrNo() bool {
+	for {
+		k, err := l.readAnswer()
+		if err != nil {
+			return false
+		}
+		switch k.Code {
+		case 'y', 'Y', ' ':
+			return true
+		case 'n', 'N', 0x03, 0x07, 0x1b:
+			return false
+		}
+	}
+}
+
+// wait for an answer at the --More-- prompt and return how many more rows
+// to show: a screenful for space or y, one for enter, and none for q, n or
+// abort
+func (l *LineReader) more() int {
+	for {
+		k, err := l.readAnswer()
+		if err != nil {
+			return 0
+		}
+		switch k.Code {
+		case ' ', 'y', 'Y':
+			return l.rows - 1
+		case '\r', '\n':
+			return 1
+		case 'q', 'Q', 'n', 'N', 0x03, 0x07, 0x1b:
+			return 0
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package fineline
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMenuComplete(t *testing.T) {
+	for _, test := range []struct {
+		input, expected string
+	}{
+		{"ca\t", "cat"},
+		{"ca\t\t", "catch"},
+		{"ca\t\t\t\t\t", "cat"},
+		{"ca\x1b[Z", "caught"},
+		{"ca\t\t\x1b[Z", "cat"},
+		{"ca\t\t\x07", "ca"},
+		{"ca\t\tx", "catchx"},
+		{"ca\t\t\x1f", "ca"},
+		{"d\t", "dog"},
+		{"x ca dog\x01\x06\x06\x06\x06\t\t", "x catch dog"},
+	} {
+		l, _ := newTestReader(test.input)
+		l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+		if err := l.Bind("\t", "menu-complete"); err != nil {
+			t.Fatal(err)
+		}
+		l.getLine()
+		if line, _ := l.Buffer(); line != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, line)
+		}
+	}
+}
+
+func TestMenuCompleteTab(t *testing.T) {
+	// tab is still bound to complete, and goes on from where shift-tab
+	// started
+	l, _ := newTestReader("ca\x1b[Z\t\t")
+	l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+	l.getLine()
+	if line, _ := l.Buffer(); line != "catch" {
+		t.Errorf("expected %q, got %q", "catch", line)
+	}
+}
+
+func TestMenuCompleteViEscape(t *testing.T) {
+	r, w := io.Pipe()
+	l, _ := newTestReader("")
+	l.input.Reset(r)
+	timeouts := make(chan time.Time)
+	l.keyTimer = func(time.Duration) <-chan time.Time {
+		return timeouts
+	}
+	l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+	l.SetEditMode(ViInsertMode)
+	go func() {
+		io.WriteString(w, "ca\x1b[Z\x1b")
+		timeouts <- time.Time{}
+		io.WriteString(w, "x\r")
+	}()
+	// escape puts back what was typed, and typing goes on
+	if line, err := l.getLine(); err != nil || line != "cax\n" {
+		t.Errorf("expected %q, got %q, %v", "cax\n", line, err)
+	}
+	if l.Mode() != ViInsertMode {
+		t.Errorf("expected to stay in insert mode, got %v", l.Mode())
+	}
+}
+
+func TestMenuRender(t *testing.T) {
+	l, out := newTestReader("ca\x1b[Z")
+	l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+	l.getLine()
+	// the last one's selected, and the cursor goes back up to the line
+	expected := "$ caught\x1b[0J\r\ncat     catch   cats    \x1b[7mcaught\x1b[0m\x1b[9G\x1b[1A"
+	if !strings.HasSuffix(out.String(), expected) {
+		t.Errorf("expected output ending %q, got %q", expected, out.String())
+	}
+}
+
+func TestCandidateGrid(t *testing.T) {
+	l, _ := newTestReader("")
+	l.cols = 20
+	for _, s := range []string{"one", "two", "three", "four", "five", "six", "seven"} {
+		l.candidates = append(l.candidates, Candidate{Replacement: s})
+	}
+	l.selected = 4
+	expected := []string{
+		"one    four   seven",
+		"two    \x1b[7mfive \x1b[0m",
+		"three  six",
+	}
+	rows := l.candidateGrid()
+	if strings.Join(rows, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected rows %q, got %q", expected, rows)
+	}
+}
+
+func TestPrintCandidates(t *testing.T) {
+	for _, test := range []struct {
+		input      string
+		cols, rows int
+		expected   string
+	}{
+		{"\t\t", 20, 24, "\r\ncat     caught\r\ncatch   cough\r\ncats    dog\r\n\x1b[1G$ "},
+		{"\t\t", 80, 24, "\r\ncat     catch   cats    caught  cough   dog\r\n\x1b[1G$ "},
+		// a screenful, a line and then no more
+		{"\t\t \rq", 8, 3, "\r\ncat\r\ncatch\r\n--More--\r\x1b[Kcats\r\ncaught\r\n--More--\r\x1b[Kcough\r\n--More--\r\x1b[K\x1b[1G$ "},
+		{"\t\tq", 8, 3, "\r\ncat\r\ncatch\r\n--More--\r\x1b[K\x1b[1G$ "},
+	} {
+		l, out := newTestReader(test.input)
+		l.cols, l.rows = test.cols, test.rows
+		l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+		l.getLine()
+		if !strings.Contains(out.String(), test.expected) {
+			t.Errorf("%q: expected %q in output %q", test.input, test.expected, out.String())
+		}
+	}
+}
+
+func TestPrintCandidatesQuery(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		shown bool
+	}{
+		{"\t\ty", true},
+		{"\t\tn", false},
+		{"\t\tx\x07", false},
+	} {
+		l, out := newTestReader(test.input)
+		l.CompletionQueryItems = 6
+		l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+		l.getLine()
+		if !strings.Contains(out.String(), "\r\nDisplay all 6 possibilities? (y or n)\r\n") {
+			t.Errorf("%q: expected to be asked, got %q", test.input, out.String())
+		}
+		if shown := strings.Contains(out.String(), "caught"); shown != test.shown {
+			t.Errorf("%q: expected shown to be %v, got %q", test.input, test.shown, out.String())
+		}
+	}
+}
+
+// calls f the first time something containing s is written
+type watchWriter struct {
+	bytes.Buffer
+	s string
+	f func()
+}
+
+func (w *watchWriter) Write(p []byte) (int, error) {
+	if w.f != nil && bytes.Contains(p, []byte(w.s)) {
+		w.f()
+		w.f = nil
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestPrintCandidatesHoldsRefresh(t *testing.T) {
+	r, w := io.Pipe()
+	out := &watchWriter{s: "(y or n)"}
+	l := NewTermLineReader(nil, r, out, -1)
+	l.cols = 80
+	l.CompletionQueryItems = 2
+	l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+	asked := make(chan struct{})
+	out.f = func() {
+		l.Refresh()
+		close(asked)
+	}
+	go func() {
+		io.WriteString(w, "\t\t")
+		<-asked
+		io.WriteString(w, "n\r")
+	}()
+	l.getLine()
+	// the line isn't drawn over the question before it's answered
+	if !strings.Contains(out.String(), "(y or n)\r\n\x1b[1G$ ") {
+		t.Errorf("expected the answer right after the question, got %q", out.String())
+	}
+}
+
+func TestPrintCandidatesMultiLine(t *testing.T) {
+	l, out := newTestReader("c\rd\x10\t\t")
+	l.Validator = semicolon
+	l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+	l.getLine()
+	// the list goes under the second row, and the line's drawn again
+	// after it
+	expected := "\x1b[1G\x1b[1B\r\ncat     catch   cats    caught  cough\r\n\x1b[1G$ c\x1b[K\r\n> d"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("expected %q in output %q", expected, out.String())
+	}
+}
+
+func TestMenuSelect(t *testing.T) {
+	for _, test := range []struct {
+		input, expected string
+	}{
+		{"ca\t\r", "cat"},
+		{"ca\t\r!", "cat!"},
+		{"ca\t\x1b[B\r", "catch"},
+		{"ca\t\t\t\r", "cats"},
+		{"ca\t\x1b[A\r", "caught"},
+		{"c\t\x1b[6~\r", "cough"},
+		{"c\t\x1b[6~\x1b[5~\r", "cat"},
+		// typing changes the candidates
+		{"ca\tu\r", "caught"},
+		{"ca\t\x7f\x1b[A\r", "cough"},
+		{"ca\tx\r", "cax\n"},
+		{"ca\t\x07", "ca"},
+		{"ca\t\x01!", "!ca"},
+		// the candidates for the word after the space go with it
+		{"dog \t\x7f\x07", "dog"},
+	} {
+		l, _ := newTestReader(test.input)
+		l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+		if err := l.Bind("\t", "menu-select"); err != nil {
+			t.Fatal(err)
+		}
+		l.getLine()
+		if line, _ := l.Buffer(); line != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, line)
+		}
+		if l.menu != noMenu {
+			t.Errorf("%q: the menu's still open", test.input)
+		}
+	}
+}
+
+func TestMenuSelectRender(t *testing.T) {
+	l, out := newTestReader("x ca\t\x1b[B")
+	l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+	l.Bind("\t", "menu-select")
+	l.getLine()
+	// the list goes under the word, and the cursor goes back up to the line
+	expected := "$ x ca\x1b[0J\r\n    cat\r\n    \x1b[7mcatch \x1b[0m\r\n    cats\r\n    caught\x1b[7G\x1b[4A"
+	if !strings.HasSuffix(out.String(), expected) {
+		t.Errorf("expected output ending %q, got %q", expected, out.String())
+	}
+}
+
+func TestMenuScroll(t *testing.T) {
+	l, _ := newTestReader("")
+	for i := 0; i < 15; i++ {
+		l.candidates = append(l.candidates, Candidate{Replacement: string('a' + rune(i))})
+	}
+	l.menu = menuList
+	for _, test := range []struct{ selected, top int }{
+		{0, 0}, {9, 0}, {12, 3}, {14, 5}, {6, 5}, {2, 2},
+	} {
+		l.selected = test.selected
+		rows := l.candidateGrid()
+		if l.menuTop != test.top || len(rows) != maxMenuRows {
+			t.Errorf("selecting %d: expected %d rows from %d, got %d from %d", test.selected, maxMenuRows, test.top, len(rows), l.menuTop)
+		}
+	}
+}
+
+func TestMenuStale(t *testing.T) {
+	l, _ := newTestReader("")
+	l.buf.WriteString("dog", 0)
+	l.candidates = []Candidate{{Replacement: "cat", Start: 4, End: 4}}
+	l.menu = menuList
+	if rows := l.candidateGrid(); rows != nil {
+		t.Errorf("expected no menu for candidates past the line, got %q", rows)
+	}
+}
+
+func TestMenuHeight(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		bind     string
+		expected string
+	}{
+		// three rows fit under the line on a four row terminal, and the
+		// cursor goes back up past them
+		{"c\t", "menu-select", "\r\n \x1b[7mcat   \x1b[0m\r\n catch\r\n cats\x1b[4G\x1b[3A"},
+		// page down moves a menu's height
+		{"c\t\x1b[6~", "menu-select", "\r\n catch\r\n cats\r\n \x1b[7mcaught\x1b[0m\x1b[4G\x1b[3A"},
+		{"c\t", "menu-complete", "\r\n\x1b[7mcat   \x1b[0m\r\ncatch\r\ncats\x1b[6G\x1b[3A"},
+	} {
+		l, out := newTestReader(test.input)
+		l.cols, l.rows = 8, 4
+		l.SetCompleter(AdaptCompleter(NewSimpleCompleter(simpleList)))
+		l.Bind("\t", test.bind)
+		l.getLine()
+		if !strings.HasSuffix(out.String(), test.expected) {
+			t.Errorf("%q with %s: expected output ending %q, got %q", test.input, test.bind, test.expected, out.String())
+		}
+	}
+}
@@ -1,11 +1,12 @@
 package fineline
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -29,44 +30,91 @@ const (
 	opEof
 	opSubmit
 	opTranspose
-	opEscape
+	opAbort
+	opSearchBackward
+	opSearchForward
+	opYank
+	opYankPop
+	opUndo
+	opRedo
+	opForwardWord
+	opBackwardWord
+	opKillWord
+	opBackwardKillWord
+	opUnixWordRubout
+	opTransposeWords
+	opUpcaseWord
+	opDowncaseWord
+	opCapitalizeWord
+	opViMovementMode
+	opViEditingMode
+	opEmacsEditingMode
+	opMenuComplete
+	opMenuCompleteBackward
+	opMenuSelect
 	noop
 )
 
-var keyMap = [...]int{
-	1:    opHome,      // ctrl-a
-	2:    opLeft,      // ctrl-b
-	3:    opCancel,    // ctrl-c
-	4:    opEof,       // ctrl-d
-	5:    opEnd,       // ctrl-e
-	6:    opRight,     // ctrl-f
-	7:    noop,        // ctrl-g
-	8:    opBackspace, // ctrl-h
-	'\t': opComplete,
-	'\r': opSubmit,
-	11:   opDeleteToEnd, // ctrl-k
-	12:   opClear,       // ctrl-l
-	'\n': opSubmit,
-	14:   noop,                // ctrl-n
-	15:   opSubmit,            // ctrl-o
-	16:   opUp,                // ctrl-p
-	17:   noop,                // ctrl-q; should be quoted insert
-	18:   noop,                // ctrl-r; should be reverse history search
-	19:   noop,                // ctrl-s; should be forward history search?
-	20:   opTranspose,         // ctrl-t
-	21:   opDeleteToBeginning, // ctrl-u
-	22:   noop,                // ctrl-v; should be quoted insert
-	23:   noop,                // ctrl-w; should be kill word
-	24:   noop,                // ctrl-x; should be something?
-	25:   noop,                // ctrl-y; should be yank
-	26:   noop,                // ctrl-z
-	27:   opEscape,
-	127:  opBackspace,
+type keyBinding struct {
+	seq string
+	op  int
+}
+
+// the default key bindings; each LineReader gets its own copy
+var defaultKeys = []keyBinding{
+	{"\x01", opHome},      // ctrl-a
+	{"\x02", opLeft},      // ctrl-b
+	{"\x03", opCancel},    // ctrl-c
+	{"\x04", opEof},       // ctrl-d
+	{"\x05", opEnd},       // ctrl-e
+	{"\x06", opRight},     // ctrl-f
+	{"\x07", opAbort},     // ctrl-g
+	{"\x08", opBackspace}, // ctrl-h
+	{"\t", opComplete},
+	{"\x1b[Z", opMenuCompleteBackward}, // shift-tab
+	{"\r", opSubmit},
+	{"\x0b", opDeleteToEnd}, // ctrl-k
+	{"\x0c", opClear},       // ctrl-l
+	{"\n", opSubmit},
+	{"\x0e", opDown},              // ctrl-n
+	{"\x0f", opSubmit},            // ctrl-o
+	{"\x10", opUp},                // ctrl-p
+	{"\x12", opSearchBackward},    // ctrl-r
+	{"\x13", opSearchForward},     // ctrl-s
+	{"\x14", opTranspose},         // ctrl-t
+	{"\x15", opDeleteToBeginning}, // ctrl-u
+	{"\x17", opUnixWordRubout},    // ctrl-w
+	{"\x19", opYank},              // ctrl-y
+	{"\x1f", opUndo},              // ctrl-_
+	{"\x1b", opAbort},             // a lone escape
+	{"\x7f", opBackspace},
+	{"\x1b[A", opUp},
+	{"\x1b[B", opDown},
+	{"\x1b[C", opRight},
+	{"\x1b[D", opLeft},
+	{"\x1b[F", opEnd},
+	{"\x1b[H", opHome},
+	{"\x1b[3~", opDelete},
+	{"\x1by", opYankPop},
+	{"\x18\x15", opUndo}, // ctrl-x ctrl-u
+	{"\x1bf", opForwardWord},
+	{"\x1bb", opBackwardWord},
+	{"\x1bd", opKillWord},
+	{"\x1b\x7f", opBackwardKillWord},
+	{"\x1b\x08", opBackwardKillWord},
+	{"\x1bt", opTransposeWords},
+	{"\x1bu", opUpcaseWord},
+	{"\x1bl", opDowncaseWord},
+	{"\x1bc", opCapitalizeWord},
+	{"\x1b[1;5C", opForwardWord},  // ctrl-right
+	{"\x1b[1;5D", opBackwardWord}, // ctrl-left
+	{"\x1b[1;3C", opForwardWord},  // alt-right
+	{"\x1b[1;3D", opBackwardWord}, // alt-left
 }
 
 var cancelled = errors.New("line cancelled")
 
-func (l *LineReader) exec(r *bufio.Reader, op int, c rune) (bool, error) {
+func (l *LineReader) exec(op int, c rune) (bool, error) {
 	if op != opComplete {
 		l.display = false
 	}
@@ -89,6 +137,12 @@ func (l *LineReader) exec(r *bufio.Reader, op int, c rune) (bool, error) {
 		l.end()
 	case opRight:
 		l.right()
+	case opDelete:
+		l.delete()
+	case opUp:
+		l.up()
+	case opDown:
+		l.down()
 	case opBackspace:
 		l.backspace()
 	case opComplete:
@@ -102,108 +156,108 @@ func (l *LineReader) exec(r *bufio.Reader, op int, c rune) (bool, error) {
 	case opClear:
 		l.clearScreen()
 	case opSubmit:
-		l.putc('\n')
-		l.setCursor(0, -l.y)
+		if l.Validator != nil && !l.Validator(l.buf.String()) {
+			l.putc('\n')
+			break
+		}
+		l.pos = l.buf.len()
+		l.refreshLine()
+		l.buf.WriteByte('\n', l.pos)
+		l.pos++
+		// the terminal's already on a new row if the line filled the last one
+		if l.x == 0 && l.y > 0 {
+			fmt.Fprint(l.output, "\r")
+		} else {
+			fmt.Fprint(l.output, "\r\n")
+		}
 		return false, nil
 	case opTranspose:
 		l.transpose()
 	case opDeleteToBeginning:
 		l.deleteToBeginning()
-	case opEscape:
-		var seq [2]byte
-		r.Read(seq[:])
-		if seq[0] == 91 {
-			if 48 < seq[1] && seq[1] < 55 {
-				// extended escape
-				var seq2 [2]byte
-				_, err := r.Read(seq2[:])
-				if err != nil {
-					break
-				}
-				if seq[1] == 51 && seq2[0] == 126 {
-					// delete
-					l.delete()
-				}
-				break
-			}
-			switch seq[1] {
-			case 65:
-				// up arrow
-				l.currentEntry--
-				if l.currentEntry < 0 {
-					l.currentEntry = len(l.history) - 1
-				}
-			case 66:
-				// down arrow
-				l.currentEntry++
-				if l.currentEntry > len(l.history) {
-					l.currentEntry = 0
-				}
-			case 67:
-				// right arrow
-				l.right()
-			case 68:
-				// left arrow
-				l.left()
-			case 70:
-				// end
-				l.end()
-			case 72:
-				// home
-				l.home()
-			}
-		} else if seq[0] == 79 {
-			switch seq[1] {
-			case 70:
-				// end
-				l.end()
-			case 72:
-				// home
-				l.home()
-			}
+	case opYank:
+		l.yank()
+	case opYankPop:
+		l.yankPop()
+	case opUndo:
+		l.undoChange()
+	case opRedo:
+		l.redoChange()
+	case opForwardWord:
+		l.forwardWord()
+	case opBackwardWord:
+		l.backwardWord()
+	case opKillWord:
+		l.killWord()
+	case opBackwardKillWord:
+		l.backwardKillWord()
+	case opUnixWordRubout:
+		l.unixWordRubout()
+	case opTransposeWords:
+		l.transposeWords()
+	case opUpcaseWord:
+		l.caseWord(strings.ToUpper)
+	case opDowncaseWord:
+		l.caseWord(strings.ToLower)
+	case opCapitalizeWord:
+		l.capitalizeWord()
+	case opViMovementMode:
+		l.viMovementMode()
+	case opViEditingMode:
+		l.setMode(ViInsertMode)
+		l.refreshLine()
+	case opEmacsEditingMode:
+		l.setMode(EmacsMode)
+		l.refreshLine()
+	case opMenuComplete, opMenuCompleteBackward:
+		if l.c != nil {
+			return l.menuComplete(op == opMenuCompleteBackward)
 		}
+	case opMenuSelect:
+		if l.c != nil {
+			return l.menuSelect()
+		}
+	case opSearchBackward:
+		return l.search(true)
+	case opSearchForward:
+		return l.search(false)
 	}
 	return true, nil
 }
 
 func (l *LineReader) putc(c rune) {
+	l.saveUndo()
 	l.buf.WriteRune(c, l.pos)
-	l.pos++
+	l.pos += utf8.RuneLen(c)
+	l.refreshLine()
+}
+
+// replace the whole line with s and move the cursor to the end
+func (l *LineReader) setLine(s string) {
+	l.resetUndo()
+	l.buf.reset()
+	l.buf.WriteString(s, 0)
+	l.pos = len(s)
 	l.refreshLine()
 }
 
 func (l *LineReader) puts(s string) {
+	l.saveUndo()
 	l.buf.WriteString(s, l.pos)
 	l.pos += len(s)
 	l.refreshLine()
 }
 
-// finds the longest common string between the end of the first string and the
-// beginning of the second
-func findIntersect(head, tail string) string {
-	n, m := len(head), len(tail)
-	if n == 0 || m == 0 {
-		return ""
-	}
-	for len(tail) > 0 {
-		pos := strings.LastIndex(head, tail)
-		if pos >= 0 {
-			return head[pos:]
-		}
-		tail = tail[:len(tail)-1]
-	}
-	return ""
-}
-
-// finds the longest common prefix of two strings
+// finds the longest common prefix of two strings, in whole characters, so
+// that it doesn't end partway through one
 func commonPrefix(x, y string) string {
-	n, m := len(x), len(y)
-	if m < n {
-		n = m
-	}
 	i := 0
-	for i < n && x[i] == y[i] {
-		i++
+	for i < len(x) && i < len(y) {
+		j := nextGrapheme(x, i)
+		if j != nextGrapheme(y, i) || x[i:j] != y[i:j] {
+			break
+		}
+		i = j
 	}
 	return x[:i]
 }
@@ -214,121 +268,359 @@ func (l *LineReader) complete() {
 		return
 	}
 	str := l.buf.String()
-	candidates := l.c.Complete(str[:l.pos])
-	n := len(candidates)
-	if n == 0 {
+	candidates := l.c.Candidates(str[:l.pos], str[l.pos:])
+	if len(candidates) == 0 {
+		return
+	}
+	c := candidates[0]
+	if c.Start < 0 || c.Start > c.End || c.End > len(str) {
 		return
 	}
-	var complete string
-	if n == 1 {
-		complete = candidates[0]
-	} else {
-		// look for a common prefix to see if we can fill in anything
-		prefix := commonPrefix(candidates[0], candidates[1])
-		for i := 2; i < n && prefix != str; i++ {
-			prefix = commonPrefix(prefix, candidates[i])
+	if len(candidates) == 1 {
+		if c.Replacement != str[c.Start:c.End] {
+			l.replace(c.Start, c.End, c.Replacement)
 		}
-		complete = prefix
-		l.display = true
-		l.candidates = candidates
+		return
 	}
-	inter := findIntersect(str, complete)
-	if inter == complete {
+	l.display = true
+	l.candidates = candidates
+	// look for a common prefix to see if we can fill in anything, as long
+	// as they all replace the same text. It only takes the place of what's
+	// before the cursor, since the rest of the word might still be wanted.
+	if c.Start > l.pos {
 		return
 	}
-	l.puts(complete[len(inter):])
-	l.refreshLine()
+	complete := c.Replacement
+	for _, d := range candidates[1:] {
+		if d.Start != c.Start || d.End != c.End {
+			return
+		}
+		complete = commonPrefix(complete, d.Replacement)
+	}
+	// that mustn't lose any of what's been typed
+	if typed := str[c.Start:l.pos]; complete != typed && strings.HasPrefix(complete, typed) {
+		l.replace(c.Start, l.pos, complete)
+	}
 }
 
 func (l *LineReader) backspace() {
 	if l.pos > 0 {
-		l.pos--
-		l.buf.remove(l.pos)
+		l.saveUndo()
+		start := l.prevChar(l.pos)
+		l.buf.remove(start, l.pos)
+		l.pos = start
 		l.refreshLine()
 	}
 }
 
 // delete the character in front of the cursor, like the delete key
 func (l *LineReader) delete() {
-	l.buf.remove(l.pos)
+	if l.pos == l.buf.len() {
+		return
+	}
+	l.saveUndo()
+	l.buf.remove(l.pos, l.nextChar(l.pos))
 	l.refreshLine()
 }
 
 func (l *LineReader) deleteToBeginning() {
-	l.buf.pretruncate(l.pos)
-	l.pos = 0
-	l.refreshLine()
+	l.kill(0, l.pos)
 }
 
 func (l *LineReader) deleteToEnd() {
-	l.buf.truncate(l.pos)
-	l.refreshLine()
+	l.kill(l.pos, l.buf.len())
 }
 
+// move to the start of the line the cursor's on
 func (l *LineReader) home() {
-	l.pos = 0
+	l.pos = l.lineStart(l.pos)
 	l.refreshLine()
 }
 
+// move to the end of the line the cursor's on
 func (l *LineReader) end() {
-	l.pos = l.buf.len()
+	if l.acceptHint(false) {
+		return
+	}
+	l.pos = l.lineEnd(l.pos)
 	l.refreshLine()
 }
 
+// move to the line above, keeping to the same column, or to the previous
+// history entry from the first line
+func (l *LineReader) up() {
+	start := l.lineStart(l.pos)
+	if start == 0 {
+		l.historyPrev()
+		return
+	}
+	col := l.column(l.pos)
+	l.pos = l.atColumn(l.lineStart(start-1), col)
+	l.refreshLine()
+}
+
+// move to the line below, keeping to the same column, or to the next
+// history entry from the last line
+func (l *LineReader) down() {
+	end := l.lineEnd(l.pos)
+	if end == l.buf.len() {
+		l.historyNext()
+		return
+	}
+	col := l.column(l.pos)
+	l.pos = l.atColumn(end+1, col)
+	l.refreshLine()
+}
+
+// returns the start of the line of the buffer that pos is on
+func (l *lineReader) lineStart(pos int) int {
+	return bytes.LastIndexByte(l.buf.Bytes()[:pos], '\n') + 1
+}
+
+// returns the end of the line of the buffer that pos is on, before any
+// newline
+func (l *lineReader) lineEnd(pos int) int {
+	if i := bytes.IndexByte(l.buf.Bytes()[pos:], '\n'); i >= 0 {
+		return pos + i
+	}
+	return l.buf.len()
+}
+
+// returns the width of the prompt before the line starting at start
+func (l *lineReader) promptWidth(start int) int {
+	if start == 0 {
+		x, _ := l.promptEnd(l.prompt)
+		return x
+	}
+	return l.continuationWidth()
+}
+
+// returns the column pos is at, ignoring wrapping
+func (l *lineReader) column(pos int) int {
+	start := l.lineStart(pos)
+	return l.promptWidth(start) + stringWidth(string(l.buf.Bytes()[start:pos]))
+}
+
+// returns the position in the line starting at start that's at col, or
+// the nearest one before it
+func (l *lineReader) atColumn(start, col int) int {
+	str := l.buf.String()
+	x, pos := l.promptWidth(start), start
+	for pos < len(str) && str[pos] != '\n' {
+		next := nextGrapheme(str, pos)
+		w := stringWidth(str[pos:next])
+		if x+w > col {
+			break
+		}
+		x, pos = x+w, next
+	}
+	return pos
+}
+
+// swap the characters on either side of the cursor, or the last two if the
+// cursor's at the end of the line
 func (l *LineReader) transpose() {
-	l.buf.transpose(l.pos)
+	mid := l.pos
+	if mid == l.buf.len() {
+		mid = l.prevChar(mid)
+	}
+	if mid == 0 {
+		return
+	}
+	l.saveUndo()
+	l.buf.swap(l.prevChar(mid), mid, l.nextChar(mid))
 	l.refreshLine()
 }
 
 // move the cursor left
 func (l *LineReader) left() {
 	if l.pos > 0 {
-		l.pos--
+		l.pos = l.prevChar(l.pos)
 		l.refreshLine()
 	}
 }
 
 // move the cursor right
 func (l *LineReader) right() {
+	if l.acceptHint(false) {
+		return
+	}
 	if l.pos < l.buf.len() {
-		l.pos++
+		l.pos = l.nextChar(l.pos)
 		l.refreshLine()
 	}
 }
 
+// returns the start of the character before pos; characters are grapheme
+// clusters, so an accented letter or a flag counts as one however it's made
+func (l *lineReader) prevChar(pos int) int {
+	return prevGrapheme(l.buf.String(), pos)
+}
+
+// returns the end of the character starting at pos
+func (l *lineReader) nextChar(pos int) int {
+	return nextGrapheme(l.buf.String(), pos)
+}
+
 func (l *LineReader) refreshLine() {
 	// move to origin of the current line
 	l.setCursor(0, -l.y)
-	// assuming the prompt won't wrap
-	fmt.Print(l.Prompt)
-	bufStr := l.buf.String()
-	n := len(bufStr)
-	pl := len(l.Prompt)
-	if n > l.cols-pl {
-		n = l.cols - pl
-	}
-	fmt.Print(bufStr[:n])
-	bufStr = bufStr[n:]
-	l.lines = 0
-	wrapCursor := n == l.cols-pl
-	n = len(bufStr)
-	for n > 0 {
-		if n > l.cols {
-			n = l.cols
-		}
-		fmt.Print(bufStr[:n])
-		bufStr = bufStr[n:]
-		wrapCursor = n == l.cols
-		n = len(bufStr)
-		l.lines++
+	l.prompt, l.rightPrompt = l.prompts()
+	l.writePrompt(l.prompt)
+	l.writeBuf()
+	str := l.buf.String()
+	px, py := l.promptEnd(l.prompt)
+	x, y := l.advance(str, px, py)
+	l.updateHint()
+	if l.hint != "" {
+		l.writeHint(x)
+		x, y = l.advance(l.hint, x, y)
 	}
+	// the number of lines we wrapped onto
+	l.lines = y
 	l.eraseToEnd()
-	if wrapCursor {
+	if x == l.cols {
+		// the terminal's waiting to wrap
 		l.lines++
 		// move to next line
-		fmt.Print("\n")
+		fmt.Fprint(l.output, "\n")
+	}
+	// the row we're on
+	row := l.lines
+	if l.menu != noMenu {
+		row += l.writeMenu(x == l.cols)
+	}
+	if l.rightPromptFits(px, py) {
+		w := stringWidth(visiblePrompt(l.rightPrompt))
+		// leave the last column empty so the terminal doesn't wrap
+		l.setCursor(l.cols-w-1, py-row)
+		fmt.Fprint(l.output, printedPrompt(l.rightPrompt))
+		row = py
+	}
+	l.x, l.y = l.cursorPos(px, py)
+	l.setCursor(l.x, l.y-row)
+}
+
+// returns where the cursor goes with the prompt ending at px, py: where the
+// next character will be drawn
+func (l *lineReader) cursorPos(px, py int) (x, y int) {
+	str := l.buf.String()
+	x, y = l.advance(str[:l.pos], px, py)
+	next := str[l.pos:nextGrapheme(str, l.pos)]
+	if next == "\n" {
+		next = ""
+	}
+	if x == l.cols || x+graphemeWidth(next) > l.cols {
+		x, y = 0, y+1
+	}
+	return x, y
+}
+
+// draw the line again for a terminal that's now cols wide. Terminals rewrap
+// the rows already on the screen to the new width, keeping the cursor on the
+// same character, so the row it's on is worked out again for the new width
+// to find the way back up to the start of the prompt.
+func (l *LineReader) reflow(cols int) {
+	if cols == l.cols {
+		return
+	}
+	px, py := l.promptEnd(l.prompt)
+	lines := strings.Split(visiblePrompt(l.prompt), "\n")
+	first := lines[len(lines)-1] + l.buf.String() + l.hint
+	if i := strings.IndexByte(first, '\n'); i >= 0 {
+		first = first[:i]
+	}
+	// the right prompt fills its row, which can take more rows than the
+	// text on it once rewrapped. That only matters when the cursor's below.
+	filled := 0
+	if l.y > py && l.rightPromptFits(px, py) {
+		_, rows := l.advance(first, 0, 0)
+		filled = rows*l.cols + l.cols - 1
+	}
+	l.cols = cols
+	px, py = l.promptEnd(l.prompt)
+	_, l.y = l.cursorPos(px, py)
+	if _, rows := l.advance(first, 0, 0); filled > 0 && (filled-1)/cols > rows {
+		l.y += (filled-1)/cols - rows
+	}
+	l.refreshLine()
+}
+
+// advance returns where the cursor ends up after writing s with it at column
+// x of row y. Like terminals, it puts a wide character that doesn't fit at the
+// end of a row at the start of the next one. The returned column can be
+// l.cols, meaning the terminal will wrap before writing anything else.
+func (l *lineReader) advance(s string, x, y int) (int, int) {
+	for i := 0; i < len(s); {
+		if s[i] == '\n' {
+			x, y = l.continuationWidth(), y+1
+			i++
+			continue
+		}
+		j := nextGrapheme(s, i)
+		w := graphemeWidth(s[i:j])
+		if isControl(rune(s[i])) {
+			// ^ and the letter can wrap separately
+			w = 1
+			if x+w > l.cols {
+				x, y = 0, y+1
+			}
+			x += w
+		}
+		i = j
+		if w == 0 {
+			continue
+		}
+		if x+w > l.cols {
+			x, y = 0, y+1
+		}
+		x += w
+	}
+	return x, y
+}
+
+// write the buffer out, highlighting the highlighted part, if any
+func (l *LineReader) writeBuf() {
+	str := l.buf.String()
+	start, end := l.highlight[0], l.highlight[1]
+	x, _ := l.promptEnd(l.prompt)
+	if start >= end {
+		// the search's highlighting takes the place of the Highlighter's
+		if l.Highlighter == nil || !l.writeHighlighted(x) {
+			l.writeText(str, x, "")
+		}
+		return
+	}
+	x = l.writeText(str[:start], x, "")
+	fmt.Fprint(l.output, "\x1b[7m")
+	x = l.writeText(str[start:end], x, "\x1b[7m")
+	fmt.Fprint(l.output, "\x1b[0m")
+	l.writeText(str[end:], x, "")
+}
+
+// write s starting at column x, putting the continuation prompt at the start
+// of each new line, and return the column it ends at. style is the escape
+// sequences styling s, which are turned off for the prompt.
+func (l *LineReader) writeText(s string, x int, style string) int {
+	for {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			break
+		}
+		fmt.Fprint(l.output, visible(s[:i]))
+		if style != "" {
+			fmt.Fprint(l.output, "\x1b[0m")
+		}
+		// clear the rest of the row, unless it's full and the terminal's
+		// waiting to wrap, when that would clear the last character
+		if x, _ = l.advance(s[:i], x, 0); x < l.cols {
+			fmt.Fprint(l.output, "\x1b[K")
+		}
+		fmt.Fprint(l.output, "\r\n", printedPrompt(l.ContinuationPrompt), style)
+		s = s[i+1:]
+		x = l.continuationWidth()
 	}
-	x := (pl + l.pos) % l.cols
-	l.y = (pl + l.pos) / l.cols
-	l.setCursor(x, l.y-l.lines)
+	fmt.Fprint(l.output, visible(s))
+	x, _ = l.advance(s, x, 0)
+	return x
 }
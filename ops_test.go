@@ -0,0 +1,111 @@
+package fineline
+
+import (
+	"testing"
+)
+
+// run each input through a fresh LineReader and check the line it ends with
+func testEdits(t *testing.T, tests []struct{ input, expected string }) {
+	for _, test := range tests {
+		l, _ := newTestReader(test.input)
+		l.getLine()
+		if line, _ := l.Buffer(); line != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, line)
+		}
+	}
+}
+
+func TestKillAndYank(t *testing.T) {
+	testEdits(t, []struct{ input, expected string }{
+		{"abc\x01\x0b\x19\x19", "abcabc"},
+		{"abc\x15x\x19", "xabc"},
+		// successive kills make one entry
+		{"abc def\x02\x02\x02\x0b\x15\x19", "abc def"},
+		{"one\x15two\x15\x19\x1by", "one"},
+		{"one\x15two\x15\x19\x1by\x1by", "two"},
+		// yank-pop only works right after a yank
+		{"one\x15two\x15\x19x\x1by", "twox"},
+		{"\x19\x1by", ""},
+	})
+}
+
+func TestSharedKillRing(t *testing.T) {
+	ring := NewKillRing(2)
+	l1, _ := newTestReader("abc\x15\r")
+	l2, _ := newTestReader("x\x19\r")
+	l1.SetKillRing(ring)
+	l2.SetKillRing(ring)
+	l1.getLine()
+	if line, _ := l2.getLine(); line != "xabc\n" {
+		t.Errorf("expected %q, got %q", "xabc\n", line)
+	}
+	ring.add("1")
+	ring.add("2")
+	for _, expected := range []string{"1", "2", "1"} {
+		if s, _ := ring.rotate(); s != expected {
+			t.Errorf("expected %q, got %q", expected, s)
+		}
+	}
+}
+
+func TestUndo(t *testing.T) {
+	testEdits(t, []struct{ input, expected string }{
+		// typing is undone all at once
+		{"abc\x1f", ""},
+		{"abc\x02d\x1f", "abc"},
+		{"abc\x08\x08\x1f", "ab"},
+		{"abc\x08\x08\x1f\x1f", "abc"},
+		{"abc\x15\x1f", "abc"},
+		{"abc\x15\x18\x15", "abc"},
+		{"abc\x14\x1f", "abc"},
+		{"abc\x02\x02\x0b\x19\x19\x1f\x1f", "a"},
+		{"abc\x02\x1b[3~\x1f", "abc"},
+		{"abc\x1f\x1f\x1f", ""},
+		{"abc\x15\x1fx\x1f\x1f", ""},
+	})
+}
+
+func TestRedo(t *testing.T) {
+	l, _ := newTestReader("abc\x15\x1f\x1f\x07\x07d\x07")
+	if err := l.Bind("\x07", "redo"); err != nil {
+		t.Fatal(err)
+	}
+	l.getLine()
+	// the second redo does nothing because typing d started a new change
+	if line, _ := l.Buffer(); line != "d" {
+		t.Errorf("expected %q, got %q", "d", line)
+	}
+}
+
+func TestWords(t *testing.T) {
+	testEdits(t, []struct{ input, expected string }{
+		{"foo bar\x1bbX", "foo Xbar"},
+		{"foo bar\x1bb\x1bbX", "Xfoo bar"},
+		{"foo bar\x01\x1bfX", "fooX bar"},
+		{"foo bar\x01\x1b[1;5C\x1b[1;5CX", "foo barX"},
+		{"foo-bar baz\x1b\x7f", "foo-bar "},
+		{"foo-bar baz\x1b\x7f\x1b\x7f", "foo-"},
+		{"foo-bar baz\x17", "foo-bar "},
+		{"foo-bar baz\x17\x17", ""},
+		{"foo bar\x01\x1bd", " bar"},
+		{"foo bar\x01\x1bd\x1bd\x19", "foo bar"},
+		{"foo bar\x1bt", "bar foo"},
+		{"one two three\x1bb\x1bb\x1bt", "two one three"},
+		{"one two three\x1bb\x1bb\x1bt!", "two one! three"},
+		{"foo bar\x01\x1bu", "FOO bar"},
+		{"FOO BAR\x01\x1bf\x1bl", "FOO bar"},
+		{"foo bAR\x01\x1bc\x1bc", "Foo Bar"},
+		{"été\x01\x1bu", "ÉTÉ"},
+		{"élan vital\x01\x1bc", "Élan vital"},
+		{"foo -\x02\x02\x1bc", "foo -"},
+	})
+}
+
+func TestIsWordChar(t *testing.T) {
+	l, _ := newTestReader("foo-bar baz\x1b\x7f\x1b\x7f")
+	l.IsWordChar = func(r rune) bool { return r != ' ' }
+	l.getLine()
+	if line, _ := l.Buffer(); line != "" {
+		t.Errorf("expected %q, got %q", "", line)
+	}
+}
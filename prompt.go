@@ -0,0 +1,129 @@
+package fineline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Prompts can have escape sequences in them to color them, and like
+// readline's, can mark other invisible parts by putting them between \001
+// and \002. Neither takes up room on the screen.
+
+// returns prompt p as it's written, without the \001 and \002 markers
+func printedPrompt(p string) string {
+	if strings.IndexAny(p, "\x01\x02") < 0 {
+		return p
+	}
+	return strings.Map(func(r rune) rune {
+		if r == 1 || r == 2 {
+			return -1
+		}
+		return r
+	}, p)
+}
+
+// returns the parts of prompt p that take up room on the screen
+func visiblePrompt(p string) string {
+	if strings.IndexAny(p, "\x01\x02\x1b") < 0 {
+		return p
+	}
+	b := make([]byte, 0, len(p))
+	hidden := false
+	for i := 0; i < len(p); {
+		switch c := p[i]; {
+		case c == 1:
+			hidden = true
+			i++
+		case c == 2:
+			hidden = false
+			i++
+		case c == 0x1b && !hidden:
+			i += escapeLen(p[i:])
+		default:
+			if !hidden {
+				b = append(b, c)
+			}
+			i++
+		}
+	}
+	return string(b)
+}
+
+// write prompt p, starting a new row at each newline in it
+func (l *LineReader) writePrompt(p string) {
+	lines := strings.Split(printedPrompt(p), "\n")
+	for i, line := range lines {
+		fmt.Fprint(l.output, line)
+		if i == len(lines)-1 {
+			break
+		}
+		// clear what's left of an old row, unless the terminal's waiting
+		// to wrap, when that would clear the last character
+		if x, _ := l.advance(visiblePrompt(line), 0, 0); x < l.cols {
+			fmt.Fprint(l.output, "\x1b[K")
+		}
+		fmt.Fprint(l.output, "\r\n")
+	}
+}
+
+// returns the prompts to draw now: the search's, while searching, and
+// otherwise PromptFunc's and RightPromptFunc's, if they're set, or Prompt
+// and RightPrompt
+func (l *LineReader) prompts() (left, right string) {
+	left, right = l.Prompt, l.RightPrompt
+	switch {
+	case l.searchPrompt != "":
+		left = l.searchPrompt
+	case l.PromptFunc != nil:
+		left = l.PromptFunc()
+	}
+	if l.RightPromptFunc != nil {
+		right = l.RightPromptFunc()
+	}
+	return left, right
+}
+
+// Refresh redraws the prompt and line if Read is reading one, such as
+// when something shown by PromptFunc has changed. It's safe to call from
+// any goroutine, so a prompt can show a clock by calling it from a ticker,
+// or show something slow to work out once a goroutine has it ready.
+func (l *LineReader) Refresh() {
+	select {
+	case l.refresh <- struct{}{}:
+	default:
+		// a redraw is already on its way
+	}
+}
+
+// returns where the cursor ends up after writing prompt p from the start of
+// a row
+func (l *lineReader) promptEnd(p string) (x, y int) {
+	lines := strings.Split(visiblePrompt(p), "\n")
+	for i, line := range lines {
+		x, y = l.advance(line, 0, y)
+		if i < len(lines)-1 {
+			y++
+		}
+	}
+	return x, y
+}
+
+// returns the width of the continuation prompt
+func (l *lineReader) continuationWidth() int {
+	return stringWidth(visiblePrompt(l.ContinuationPrompt))
+}
+
+// reports whether the right prompt can go on the row the input starts on,
+// which the prompt ends at px, py, without running into the input
+func (l *LineReader) rightPromptFits(px, py int) bool {
+	if l.rightPrompt == "" {
+		return false
+	}
+	s := l.buf.String() + l.hint
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	x, y := l.advance(s, px, py)
+	// keep a space between them as well as the empty last column
+	return y == py && x < l.cols-stringWidth(visiblePrompt(l.rightPrompt))-1
+}
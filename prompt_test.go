@@ -0,0 +1,156 @@
+package fineline
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVisiblePrompt(t *testing.T) {
+	for _, test := range []struct{ in, printed, visible string }{
+		{"$ ", "$ ", "$ "},
+		{"\x1b[1;32m$\x1b[0m ", "\x1b[1;32m$\x1b[0m ", "$ "},
+		{"\x01\x1b[1m\x02>\x01\x1b[0m\x02 ", "\x1b[1m>\x1b[0m ", "> "},
+		{"a\x01hidden\x02b", "ahiddenb", "ab"},
+	} {
+		if s := printedPrompt(test.in); s != test.printed {
+			t.Errorf("%q: expected %q printed, got %q", test.in, test.printed, s)
+		}
+		if s := visiblePrompt(test.in); s != test.visible {
+			t.Errorf("%q: expected %q visible, got %q", test.in, test.visible, s)
+		}
+	}
+}
+
+func TestPromptCursor(t *testing.T) {
+	for _, test := range []struct {
+		prompt, input string
+		x, y          int
+	}{
+		{"\x1b[32m$\x1b[0m ", "ab", 4, 0},
+		{"\x01\x1b[1m\x02>\x01\x1b[0m\x02 ", "ab", 4, 0},
+		{"日本> ", "ab", 8, 0},
+		{"info\n$ ", "ab", 4, 1},
+		{"\x1b[1minfo\x1b[0m\n\n$ ", "ab\x02", 3, 2},
+		// a prompt can wrap
+		{"123456789abc", "d", 4, 1},
+	} {
+		l, out := newTestReader(test.input)
+		l.cols = 9
+		l.Prompt = test.prompt
+		l.getLine()
+		if l.x != test.x || l.y != test.y {
+			t.Errorf("%q: expected the cursor at %d,%d, got %d,%d", test.prompt,
+				test.x, test.y, l.x, l.y)
+		}
+		if strings.ContainsAny(out.String(), "\x01\x02") {
+			t.Errorf("%q: markers in output %q", test.prompt, out.String())
+		}
+	}
+}
+
+func TestMultiLinePrompt(t *testing.T) {
+	l, out := newTestReader("ab\x02")
+	l.Prompt = "info\n$ "
+	l.getLine()
+	// each redraw goes back up to the first line of the prompt
+	expected := "\x1b[1G\x1b[1Ainfo\x1b[K\r\n$ ab\x1b[0J\x1b[4G"
+	if !strings.HasSuffix(out.String(), expected) {
+		t.Errorf("expected output ending %q, got %q", expected, out.String())
+	}
+}
+
+func TestRightPrompt(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		shown bool
+	}{
+		{"ab", true},
+		{"abcdefghij", true},
+		{"abcdefghijk", false},
+		{"abcdefghijklmnopqrstuvwxyz", false},
+	} {
+		l, out := newTestReader(test.input)
+		l.cols = 20
+		l.RightPrompt = "\x1b[1m[main]\x1b[0m"
+		l.getLine()
+		// the last draw is on the first row, so the prompt is put 13
+		// columns along on it and the cursor moved back
+		x, _ := l.advance(test.input, 2, 0)
+		expected := "\x1b[14G\x1b[1m[main]\x1b[0m\x1b[" + strconv.Itoa(x+1) + "G"
+		if shown := strings.HasSuffix(out.String(), expected); shown != test.shown {
+			t.Errorf("%q: expected shown to be %v, got output %q", test.input, test.shown, out.String())
+		}
+	}
+}
+
+func TestRightPromptMultiLine(t *testing.T) {
+	l, out := newTestReader("ab\rcd")
+	l.Validator = semicolon
+	l.cols = 20
+	l.RightPrompt = "[main]"
+	l.getLine()
+	// the prompt goes up a row from the end of the input and the cursor
+	// comes back down
+	expected := "> cd\x1b[0J\x1b[14G\x1b[1A[main]\x1b[5G\x1b[1B"
+	if !strings.HasSuffix(out.String(), expected) {
+		t.Errorf("expected output ending %q, got %q", expected, out.String())
+	}
+}
+
+func TestPromptFunc(t *testing.T) {
+	l, out := newTestReader("ab\x12")
+	n := 0
+	l.PromptFunc = func() string {
+		n++
+		return strconv.Itoa(n) + "> "
+	}
+	l.RightPromptFunc = func() string {
+		return "[" + strconv.Itoa(n) + "]"
+	}
+	l.getLine()
+	// drawn fresh each time, except while searching
+	for _, s := range []string{"1> \x1b[0J\x1b[77G[1]", "2> a", "3> ab\x1b[0J\x1b[77G[3]", "(reverse-i-search)`': ab\x1b[0J\x1b[77G[3]"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in output %q", s, out.String())
+		}
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	r, w := io.Pipe()
+	l := NewTermLineReader(nil, r, new(bytes.Buffer), -1)
+	l.cols = 80
+	drawn := make(chan struct{}, 10)
+	l.PromptFunc = func() string {
+		drawn <- struct{}{}
+		return "> "
+	}
+	done := make(chan string)
+	go func() {
+		line, _ := l.getLine()
+		done <- line
+	}()
+	wait := func(what string) {
+		select {
+		case <-drawn:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for " + what)
+		}
+	}
+	wait("the first draw")
+	l.Refresh()
+	wait("a refresh with no input")
+	w.Write([]byte("ab"))
+	wait("a")
+	wait("b")
+	l.Refresh()
+	wait("a refresh after input")
+	w.Write([]byte("c\r"))
+	if line := <-done; line != "abc\n" {
+		t.Errorf("expected %q, got %q", "abc\n", line)
+	}
+}
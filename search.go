@@ -0,0 +1,155 @@
+package fineline
+
+import (
+	"strings"
+)
+
+// where an incremental search has got to after a keypress
+type searchState struct {
+	// the history entry and byte position of the match
+	entry, pos int
+	failed     bool
+	// the length of the query at this point
+	n int
+}
+
+// search history incrementally as the user types, like bash's ctrl-r.
+// Keys that don't edit the query end the search, leaving the matched line in
+// the buffer, and are then executed as usual. Abort, which is ctrl-g or
+// escape by default, puts the original line back.
+func (l *LineReader) search(reverse bool) (bool, error) {
+	origLine, origPos, origEntry := l.buf.String(), l.pos, l.currentEntry
+	if l.currentEntry < 0 {
+		l.draft = origLine
+	}
+	l.searchStart, l.searchEntry = origLine, origEntry
+	query := ""
+	// one state for each change to the search so backspace can step back
+	states := []searchState{{origEntry, origPos, false, 0}}
+	for {
+		cur := states[len(states)-1]
+		query = query[:cur.n]
+		l.showSearch(query, cur, reverse)
+		b, k, err := l.readBinding(l.keymap())
+		if err != nil {
+			l.searchPrompt = ""
+			return false, err
+		}
+		switch op := b.op; op {
+		case opPutc:
+			query += string(k.Code)
+			// the current match might still match
+			states = append(states, l.searchHistory(query, cur, reverse, false))
+		case opBackspace:
+			if len(states) > 1 {
+				states = states[:len(states)-1]
+			}
+		case opSearchBackward, opSearchForward:
+			reverse = op == opSearchBackward
+			if query != "" {
+				states = append(states, l.searchHistory(query, cur, reverse, true))
+			}
+		case opAbort:
+			l.endSearch(origEntry)
+			l.buf.reset()
+			l.buf.WriteString(origLine, 0)
+			l.pos = origPos
+			l.refreshLine()
+			return true, nil
+		default:
+			if cur.entry != origEntry {
+				l.resetUndo()
+			}
+			l.endSearch(cur.entry)
+			l.refreshLine()
+			return l.run(b, k)
+		}
+	}
+}
+
+// show the line and the search prompt for state s
+func (l *LineReader) showSearch(query string, s searchState, reverse bool) {
+	prompt := "(i-search)`"
+	if reverse {
+		prompt = "(reverse-i-search)`"
+	}
+	if s.failed {
+		prompt = "(failed " + prompt[1:]
+	}
+	l.searchPrompt = prompt + query + "': "
+	l.buf.reset()
+	l.buf.WriteString(l.searchLine(s.entry), 0)
+	l.pos = s.pos
+	l.highlight = [2]int{}
+	if !s.failed {
+		l.highlight = [2]int{s.pos, s.pos + len(query)}
+	}
+	l.refreshLine()
+}
+
+func (l *LineReader) endSearch(entry int) {
+	l.searchPrompt = ""
+	l.highlight = [2]int{}
+	l.currentEntry = entry
+}
+
+// returns entry n of the history, where -1 is the line being edited, or
+// the line the search started from in place of its entry
+func (l *LineReader) searchLine(n int) string {
+	if n == l.searchEntry {
+		return l.searchStart
+	}
+	if n < 0 {
+		return l.draft
+	}
+	return l.historyEntry(n)
+}
+
+// find the closest match for query, starting at the match in from and moving
+// toward older lines if reverse is set or newer ones if not. If next is set,
+// from's match itself doesn't count.
+// If there is no match, the returned state is from, marked failed.
+func (l *LineReader) searchHistory(query string, from searchState, reverse, next bool) searchState {
+	n, pos := from.entry, from.pos
+	for -1 <= n && n < l.numEntries {
+		line := l.searchLine(n)
+		i := -1
+		if reverse {
+			end := pos + len(query)
+			if next {
+				end--
+			}
+			if pos < 0 || end > len(line) {
+				end = len(line)
+			}
+			if end >= 0 {
+				i = strings.LastIndex(line[:end], query)
+			}
+		} else {
+			start := pos
+			if next {
+				start++
+			}
+			if start <= len(line) {
+				if i = strings.Index(line[start:], query); i >= 0 {
+					i += start
+				}
+			}
+		}
+		if i >= 0 {
+			return searchState{n, i, false, len(query)}
+		}
+		// search the whole of the next line
+		next = false
+		pos = 0
+		if reverse {
+			n++
+			pos = -1
+		} else {
+			n--
+		}
+	}
+	from.failed = true
+	from.n = len(query)
+	return from
+}
@@ -6,11 +6,11 @@ import (
 	"syscall"
 )
 
-func tcgetattr(fd int, t *termios) {
-	ttyIoctl(0, syscall.TIOCGETA, t)
+func tcgetattr(fd int, t *termios) error {
+	return ttyIoctl(fd, syscall.TIOCGETA, t)
 }
 
-func tcsetattr(fd, op int, t *termios) {
+func tcsetattr(fd, op int, t *termios) error {
 	var cmd uintptr
 	switch op {
 	case TCSANOW:
@@ -20,5 +20,5 @@ func tcsetattr(fd, op int, t *termios) {
 	case TCSAFLUSH:
 		cmd = syscall.TIOCSETAF
 	}
-	ttyIoctl(0, cmd, t)
+	return ttyIoctl(fd, cmd, t)
 }
@@ -4,11 +4,11 @@ import (
 	"syscall"
 )
 
-func tcgetattr(fd int, t *termios) {
-	ttyIoctl(0, syscall.TCGETS, t)
+func tcgetattr(fd int, t *termios) error {
+	return ttyIoctl(fd, syscall.TCGETS, t)
 }
 
-func tcsetattr(fd, op int, t *termios) {
+func tcsetattr(fd, op int, t *termios) error {
 	var cmd uintptr
 	switch op {
 	case TCSANOW:
@@ -18,5 +18,5 @@ func tcsetattr(fd, op int, t *termios) {
 	case TCSAFLUSH:
 		cmd = TCSETSF
 	}
-	ttyIoctl(0, cmd, t)
+	return ttyIoctl(fd, cmd, t)
 }
@@ -0,0 +1,63 @@
+package fineline
+
+// the line and cursor as they were before a change
+type undoState struct {
+	line string
+	pos  int
+}
+
+// remember the line as it is so that the change about to be made can be
+// undone. Only the first change in each command is remembered, and a run of
+// typed characters is undone all at once, as in readline.
+func (l *LineReader) saveUndo() {
+	if l.changed {
+		return
+	}
+	l.changed = true
+	if l.mode == ViInsertMode {
+		// as in vi, everything done in one go in insert mode is undone
+		// at once, along with the command that started it
+		if l.vi.insertSaved {
+			return
+		}
+		l.vi.insertSaved = true
+	} else if l.op == opPutc && l.lastOp == opPutc && len(l.undo) > 0 {
+		return
+	}
+	l.undo = append(l.undo, undoState{l.buf.String(), l.pos})
+	l.redo = l.redo[:0]
+}
+
+// forget all changes, such as when a different line is loaded
+func (l *LineReader) resetUndo() {
+	l.undo = l.undo[:0]
+	l.redo = l.redo[:0]
+	l.vi.insertSaved = false
+}
+
+// take back the last change
+func (l *LineReader) undoChange() {
+	if len(l.undo) == 0 {
+		return
+	}
+	l.redo = append(l.redo, undoState{l.buf.String(), l.pos})
+	l.restoreUndo(l.undo[len(l.undo)-1])
+	l.undo = l.undo[:len(l.undo)-1]
+}
+
+// make the last change taken back again
+func (l *LineReader) redoChange() {
+	if len(l.redo) == 0 {
+		return
+	}
+	l.undo = append(l.undo, undoState{l.buf.String(), l.pos})
+	l.restoreUndo(l.redo[len(l.redo)-1])
+	l.redo = l.redo[:len(l.redo)-1]
+}
+
+func (l *LineReader) restoreUndo(s undoState) {
+	l.buf.reset()
+	l.buf.WriteString(s.line, 0)
+	l.pos = s.pos
+	l.refreshLine()
+}
@@ -0,0 +1,753 @@
+package fineline
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An EditMode is a way of interpreting the keys that are typed.
+type EditMode int
+
+const (
+	// EmacsMode is the default. Keys run the commands they're bound to and
+	// printable ones insert themselves, as in GNU readline.
+	EmacsMode EditMode = iota
+	// ViInsertMode is vi's insert mode. Typed characters are inserted and
+	// escape switches to ViCommandMode.
+	ViInsertMode
+	// ViCommandMode is vi's command mode, where keys are motions and
+	// commands such as "dw", "3x" or "ci(".
+	ViCommandMode
+)
+
+// the key bindings for vi's insert mode
+var viInsertKeys = []keyBinding{
+	{"\x03", opCancel},    // ctrl-c
+	{"\x04", opEof},       // ctrl-d
+	{"\x07", opAbort},     // ctrl-g
+	{"\x08", opBackspace}, // ctrl-h
+	{"\t", opComplete},
+	{"\x1b[Z", opMenuCompleteBackward}, // shift-tab
+	{"\r", opSubmit},
+	{"\x0c", opClear}, // ctrl-l
+	{"\n", opSubmit},
+	{"\x0e", opDown},              // ctrl-n
+	{"\x10", opUp},                // ctrl-p
+	{"\x12", opSearchBackward},    // ctrl-r
+	{"\x13", opSearchForward},     // ctrl-s
+	{"\x14", opTranspose},         // ctrl-t
+	{"\x15", opDeleteToBeginning}, // ctrl-u
+	{"\x17", opUnixWordRubout},    // ctrl-w
+	{"\x19", opYank},              // ctrl-y
+	{"\x1b", opViMovementMode},
+	{"\x7f", opBackspace},
+	{"\x1b[A", opUp},
+	{"\x1b[B", opDown},
+	{"\x1b[C", opRight},
+	{"\x1b[D", opLeft},
+	{"\x1b[F", opEnd},
+	{"\x1b[H", opHome},
+	{"\x1b[3~", opDelete},
+}
+
+// what vi remembers between commands
+type viState struct {
+	// the contents of the registers, by name; " is the unnamed register
+	registers map[rune]string
+	// the last f, F, t or T and the character it looked for, for ; and ,
+	find, findChar rune
+	// the keys of the last change, without its count, and the count, for .
+	lastChange []Key
+	lastCount  int
+	// the keys read since the current command started, while recording
+	recording bool
+	keys      []Key
+	// how many of keys were the register and count, and the count
+	prefix, count int
+	// whether the current stretch of insert mode has saved an undo state
+	insertSaved bool
+}
+
+// SetEditMode switches between emacs and vi editing. In vi, each line is
+// started in insert mode.
+// Each mode has its own key bindings, and Bind, BindFunc and Unbind change
+// the current mode's. Bindings made in ViCommandMode take precedence over
+// vi's own commands.
+func (l *LineReader) SetEditMode(mode EditMode) {
+	if mode != l.mode {
+		l.setMode(mode)
+	}
+}
+
+// Mode returns the current editing mode.
+func (l *LineReader) Mode() EditMode {
+	return l.mode
+}
+
+func (l *LineReader) setMode(mode EditMode) {
+	l.mode = mode
+	l.vi.insertSaved = false
+	if l.ModeChanged != nil {
+		l.ModeChanged(mode)
+	}
+}
+
+// leave insert mode for command mode, backing the cursor onto the last
+// character typed as vi does
+func (l *LineReader) viMovementMode() {
+	v := &l.vi
+	if v.recording {
+		// the insert was started by a change, which is now complete
+		v.lastChange = append(v.lastChange[:0], v.keys[v.prefix:]...)
+		v.lastCount = v.count
+		v.recording = false
+	}
+	l.setMode(ViCommandMode)
+	if l.pos > 0 {
+		l.pos = l.prevChar(l.pos)
+	}
+	l.refreshLine()
+}
+
+// switch to insert mode for the rest of a change
+func (l *LineReader) viInsert() {
+	l.setMode(ViInsertMode)
+	// whatever's typed is undone along with the command
+	l.vi.insertSaved = l.changed
+}
+
+func (l *LineReader) viReadKey() (Key, error) {
+	k, err := l.readKey(true)
+	// escape and a key typed together come as an alt key, and escape
+	// doesn't do anything here anyway
+	k.Mod &^= ModAlt
+	return k, err
+}
+
+// read and carry out one command in vi's command mode
+func (l *LineReader) viCommand() (bool, error) {
+	l.lastOp, l.op = l.op, noop
+	l.changed = false
+	l.display = false
+	v := &l.vi
+	v.recording, v.keys = true, v.keys[:0]
+	k, err := l.viReadKey()
+	if err != nil {
+		return false, err
+	}
+	if m := l.keymap(); m.next[k] != nil {
+		v.recording = false
+		l.unreadKey(k)
+		b, k, err := l.readBinding(m)
+		if err != nil {
+			return false, err
+		}
+		return l.run(b, k)
+	}
+
+	reg := '"'
+	if k.Code == '"' {
+		if k, err = l.viReadKey(); err != nil {
+			return false, err
+		}
+		reg = k.Code
+		if k, err = l.viReadKey(); err != nil {
+			return false, err
+		}
+	}
+	count := 0
+	for isDigit(k.Code) && (k.Code != '0' || count > 0) {
+		count = count*10 + int(k.Code-'0')
+		if k, err = l.viReadKey(); err != nil {
+			return false, err
+		}
+	}
+	v.prefix, v.count = len(v.keys)-1, count
+
+	cont, change, err := l.viExec(k, reg, count)
+	if change && l.mode == ViCommandMode {
+		v.lastChange = append(v.lastChange[:0], v.keys[v.prefix:]...)
+		v.lastCount = count
+	}
+	if !change || l.mode != ViInsertMode {
+		// an insert goes on being recorded until escape
+		v.recording = false
+	}
+	if !cont || err != nil {
+		return cont, err
+	}
+	if l.mode == ViCommandMode && l.pos > 0 && l.pos == l.buf.len() {
+		l.pos = l.prevChar(l.pos)
+	}
+	l.refreshLine()
+	return true, nil
+}
+
+func isDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+// carry out the command that starts with k, given its register and count.
+// change reports whether it was a change that . should repeat.
+func (l *LineReader) viExec(k Key, reg rune, count int) (cont, change bool, err error) {
+	n := count
+	if n == 0 {
+		n = 1
+	}
+	pos, end := l.pos, l.buf.len()
+	switch k.Code {
+	case 'i':
+		l.viInsert()
+	case 'a':
+		if pos < end {
+			l.pos = l.nextChar(pos)
+		}
+		l.viInsert()
+	case 'I':
+		l.pos = l.firstNonBlank()
+		l.viInsert()
+	case 'A':
+		l.pos = end
+		l.viInsert()
+	case 'x', KeyDelete:
+		if pos == end {
+			return true, false, nil
+		}
+		l.viOperate('d', reg, pos, l.nextChars(pos, n))
+	case 'X':
+		if pos == 0 {
+			return true, false, nil
+		}
+		start := pos
+		for i := 0; i < n && start > 0; i++ {
+			start = l.prevChar(start)
+		}
+		l.viOperate('d', reg, start, pos)
+	case 's':
+		l.viOperate('c', reg, pos, l.nextChars(pos, n))
+	case 'S':
+		l.viOperate('c', reg, 0, end)
+	case 'C':
+		l.viOperate('c', reg, pos, end)
+	case 'D':
+		l.viOperate('d', reg, pos, end)
+	case 'Y':
+		l.viOperate('y', reg, 0, end)
+		l.pos = pos
+		return true, false, nil
+	case 'd', 'c', 'y':
+		start, stop, ok, err := l.viOperatorRange(k.Code, count)
+		if err != nil || !ok {
+			return err == nil, false, err
+		}
+		l.viOperate(k.Code, reg, start, stop)
+		return true, k.Code != 'y', nil
+	case 'p', 'P':
+		s := strings.Repeat(l.viRegister(reg), n)
+		if s == "" {
+			return true, false, nil
+		}
+		if k.Code == 'p' && pos < end {
+			pos = l.nextChar(pos)
+		}
+		l.saveUndo()
+		l.buf.WriteString(s, pos)
+		l.pos = l.prevChar(pos + len(s))
+	case 'r':
+		c, err := l.viReadKey()
+		if err != nil || c.Mod != 0 || !isPrintable(c.Code) {
+			return err == nil, false, err
+		}
+		if l.nextChars(pos, n-1) == end {
+			// there aren't n characters to replace
+			return true, false, nil
+		}
+		s := strings.Repeat(string(c.Code), n)
+		l.replace(pos, l.nextChars(pos, n), s)
+		l.pos = pos + len(s) - utf8.RuneLen(c.Code)
+	case '~':
+		stop := l.nextChars(pos, n)
+		if stop == pos {
+			return true, false, nil
+		}
+		l.replace(pos, stop, strings.Map(toggleCase, string(l.buf.Bytes()[pos:stop])))
+	case 'u':
+		for i := 0; i < n; i++ {
+			l.undoChange()
+		}
+		return true, false, nil
+	case 0x12: // ctrl-r
+		for i := 0; i < n; i++ {
+			l.redoChange()
+		}
+		return true, false, nil
+	case '.':
+		v := &l.vi
+		if len(v.lastChange) == 0 {
+			return true, false, nil
+		}
+		var keys []Key
+		if count == 0 {
+			count = v.lastCount
+		}
+		if count > 0 {
+			for _, c := range strconv.Itoa(count) {
+				keys = append(keys, Key{Code: c})
+			}
+		}
+		keys = append(keys, v.lastChange...)
+		l.pending = append(keys, l.pending...)
+		return true, false, nil
+	case 'k', '-', 0x10, KeyUp: // ctrl-p
+		for i := 0; i < n; i++ {
+			if l.lineStart(l.pos) > 0 {
+				l.up()
+				continue
+			}
+			l.historyPrev()
+			l.pos = 0
+		}
+		return true, false, nil
+	case 'j', '+', 0x0e, KeyDown: // ctrl-n
+		for i := 0; i < n; i++ {
+			if l.lineEnd(l.pos) < l.buf.len() {
+				l.down()
+				continue
+			}
+			l.historyNext()
+			l.pos = 0
+		}
+		return true, false, nil
+	case '\r', '\n':
+		l.op = opSubmit
+		cont, err = l.exec(opSubmit, k.Code)
+		return cont, false, err
+	case 0x03: // ctrl-c
+		cont, err = l.exec(opCancel, k.Code)
+		return cont, false, err
+	case 0x04: // ctrl-d
+		if end == 0 {
+			return false, false, io.EOF
+		}
+		return true, false, nil
+	case 0x0c: // ctrl-l
+		l.clearScreen()
+		return true, false, nil
+	default:
+		if pos, _, ok, err := l.viMotion(k, count); ok {
+			l.pos = pos
+		} else if err != nil {
+			return false, false, err
+		}
+		return true, false, nil
+	}
+	return true, true, nil
+}
+
+// read the rest of an operator's command, such as the w in dw, and return
+// the range of text it covers
+func (l *LineReader) viOperatorRange(op rune, count int) (start, end int, ok bool, err error) {
+	k, err := l.viReadKey()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	// a count after the operator multiplies any before it, so 2d3w
+	// deletes six words
+	n := 0
+	for isDigit(k.Code) && (k.Code != '0' || n > 0) {
+		n = n*10 + int(k.Code-'0')
+		if k, err = l.viReadKey(); err != nil {
+			return 0, 0, false, err
+		}
+	}
+	if n > 0 && count > 0 {
+		count *= n
+	} else if n > 0 {
+		count = n
+	}
+	pos, max := l.pos, l.buf.len()
+	switch {
+	case k.Code == op:
+		// dd, cc and yy work on the whole line
+		return 0, max, true, nil
+	case k.Code == 'i' || k.Code == 'a':
+		obj, err := l.viReadKey()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		start, end, ok = l.viTextObject(obj.Code, k.Code == 'a', count)
+		return start, end, ok, nil
+	case op == 'c' && (k.Code == 'w' || k.Code == 'W') && pos < max && l.viClass(pos, k.Code == 'W') != 0:
+		// as in vi, cw on a word changes only to the end of it
+		end = pos
+		for i := 0; i < count || i == 0; i++ {
+			for i > 0 && end < max && l.viClass(end, k.Code == 'W') == 0 {
+				end = l.nextChar(end)
+			}
+			c := l.viClass(end, k.Code == 'W')
+			for end < max && l.viClass(end, k.Code == 'W') == c {
+				end = l.nextChar(end)
+			}
+		}
+		return pos, end, true, nil
+	}
+	to, inclusive, ok, err := l.viMotion(k, count)
+	if !ok || err != nil {
+		return 0, 0, false, err
+	}
+	start, end = pos, to
+	if to < pos {
+		start, end = to, pos
+	}
+	if inclusive && end < max {
+		end = l.nextChar(end)
+	}
+	return start, end, true, nil
+}
+
+// apply the operator op (d, c or y) to the text from start to end
+func (l *LineReader) viOperate(op, reg rune, start, end int) {
+	l.viSetRegister(reg, string(l.buf.Bytes()[start:end]))
+	if op != 'y' {
+		l.saveUndo()
+		l.buf.remove(start, end)
+	}
+	l.pos = start
+	if op == 'c' {
+		l.viInsert()
+	}
+}
+
+// where the motion k, done count times, takes the cursor. inclusive is set
+// if the character it ends on is part of the text it covers, as with e and
+// f, and ok is false if k isn't a motion or the motion fails.
+func (l *LineReader) viMotion(k Key, count int) (pos int, inclusive, ok bool, err error) {
+	n := count
+	if n == 0 {
+		n = 1
+	}
+	pos, max := l.pos, l.buf.len()
+	switch k.Code {
+	case 'h', 0x08, 0x7f, KeyLeft:
+		for i := 0; i < n && pos > 0; i++ {
+			pos = l.prevChar(pos)
+		}
+	case 'l', ' ', KeyRight:
+		pos = l.nextChars(pos, n)
+	case '0', KeyHome:
+		pos = 0
+	case '^':
+		pos = l.firstNonBlank()
+	case '$', KeyEnd:
+		pos = max
+	case '|':
+		pos = l.nextChars(0, n-1)
+	case 'w', 'W':
+		for i := 0; i < n; i++ {
+			pos = l.viWordForward(pos, k.Code == 'W')
+		}
+	case 'b', 'B':
+		for i := 0; i < n; i++ {
+			pos = l.viWordBackward(pos, k.Code == 'B')
+		}
+	case 'e', 'E':
+		for i := 0; i < n; i++ {
+			pos = l.viWordEnd(pos, k.Code == 'E')
+		}
+		inclusive = true
+	case 'f', 'F', 't', 'T':
+		c, err := l.viReadKey()
+		if err != nil {
+			return 0, false, false, err
+		}
+		l.vi.find, l.vi.findChar = k.Code, c.Code
+		return l.viFind(k.Code, c.Code, n)
+	case ';', ',':
+		find := l.vi.find
+		if find == 0 {
+			return 0, false, false, nil
+		}
+		if k.Code == ',' {
+			find = toggleCase(find)
+		}
+		return l.viFind(find, l.vi.findChar, n)
+	default:
+		return 0, false, false, nil
+	}
+	return pos, inclusive, true, nil
+}
+
+// find the count'th c after the cursor for f and t, or before it for F and
+// T
+func (l *LineReader) viFind(find, c rune, count int) (pos int, inclusive, ok bool, err error) {
+	pos, max := l.pos, l.buf.len()
+	back := find == 'F' || find == 'T'
+	for i := 0; i < count; i++ {
+		for {
+			if back && pos == 0 || !back && l.nextChar(pos) >= max {
+				return 0, false, false, nil
+			}
+			if back {
+				pos = l.prevChar(pos)
+			} else {
+				pos = l.nextChar(pos)
+			}
+			if r, _ := utf8.DecodeRune(l.buf.Bytes()[pos:]); r == c {
+				break
+			}
+		}
+	}
+	switch find {
+	case 't':
+		pos = l.prevChar(pos)
+	case 'T':
+		pos = l.nextChar(pos)
+	}
+	return pos, !back, true, nil
+}
+
+// the class of the character at pos for vi's word motions: 0 for space, 1
+// for word characters and 2 for anything else. For the big word motions
+// like W, anything but space is 1.
+func (l *LineReader) viClass(pos int, big bool) int {
+	r, _ := utf8.DecodeRune(l.buf.Bytes()[pos:])
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case big || l.isWordChar(r) || l.IsWordChar == nil && r == '_':
+		return 1
+	}
+	return 2
+}
+
+// the start of the next word after pos
+func (l *LineReader) viWordForward(pos int, big bool) int {
+	max := l.buf.len()
+	if pos >= max {
+		return max
+	}
+	c := l.viClass(pos, big)
+	for pos < max && c != 0 && l.viClass(pos, big) == c {
+		pos = l.nextChar(pos)
+	}
+	for pos < max && l.viClass(pos, big) == 0 {
+		pos = l.nextChar(pos)
+	}
+	return pos
+}
+
+// the start of the word before pos
+func (l *LineReader) viWordBackward(pos int, big bool) int {
+	for pos > 0 && l.viClass(l.prevChar(pos), big) == 0 {
+		pos = l.prevChar(pos)
+	}
+	if pos == 0 {
+		return 0
+	}
+	c := l.viClass(l.prevChar(pos), big)
+	for pos > 0 && l.viClass(l.prevChar(pos), big) == c {
+		pos = l.prevChar(pos)
+	}
+	return pos
+}
+
+// the last character of the word after pos
+func (l *LineReader) viWordEnd(pos int, big bool) int {
+	max := l.buf.len()
+	if pos < max {
+		pos = l.nextChar(pos)
+	}
+	for pos < max && l.viClass(pos, big) == 0 {
+		pos = l.nextChar(pos)
+	}
+	if pos >= max {
+		return l.prevChar(max)
+	}
+	c := l.viClass(pos, big)
+	for next := l.nextChar(pos); next < max && l.viClass(next, big) == c; next = l.nextChar(pos) {
+		pos = next
+	}
+	return pos
+}
+
+// the position count characters after pos, or the end of the line
+func (l *LineReader) nextChars(pos, count int) int {
+	for i := 0; i < count && pos < l.buf.len(); i++ {
+		pos = l.nextChar(pos)
+	}
+	return pos
+}
+
+func (l *LineReader) firstNonBlank() int {
+	pos := 0
+	for pos < l.buf.len() && l.charIs(pos, unicode.IsSpace) {
+		pos = l.nextChar(pos)
+	}
+	return pos
+}
+
+func toggleCase(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
+
+// the range of the text object obj around the cursor, such as w for a word
+// or ( for a parenthesized block. around includes the space or delimiters
+// around it, as with aw and a(, rather than just what's inside, as with iw
+// and i(.
+func (l *LineReader) viTextObject(obj rune, around bool, count int) (start, end int, ok bool) {
+	switch obj {
+	case 'w', 'W':
+		return l.viWordObject(obj == 'W', around, count)
+	case '"', '\'', '`':
+		return l.viQuoteObject(byte(obj), around)
+	case '(', ')', 'b':
+		return l.viBlockObject('(', ')', around)
+	case '[', ']':
+		return l.viBlockObject('[', ']', around)
+	case '{', '}', 'B':
+		return l.viBlockObject('{', '}', around)
+	case '<', '>':
+		return l.viBlockObject('<', '>', around)
+	}
+	return 0, 0, false
+}
+
+// the word under the cursor, or the run of space if it's on space, and
+// count-1 more after it. With around, the space after the words is
+// included too, or the space before them if there's none after.
+func (l *LineReader) viWordObject(big, around bool, count int) (start, end int, ok bool) {
+	max := l.buf.len()
+	if max == 0 {
+		return 0, 0, false
+	}
+	start = l.pos
+	if start == max {
+		start = l.prevChar(max)
+	}
+	c := l.viClass(start, big)
+	for start > 0 && l.viClass(l.prevChar(start), big) == c {
+		start = l.prevChar(start)
+	}
+	end = start
+	for i := 0; i < count || i == 0; i++ {
+		c := l.viClass(end, big)
+		for end < max && l.viClass(end, big) == c {
+			end = l.nextChar(end)
+		}
+		if around && end < max && (c == 0) != (l.viClass(end, big) == 0) {
+			c = l.viClass(end, big)
+			for end < max && l.viClass(end, big) == c {
+				end = l.nextChar(end)
+			}
+		}
+		if end == max {
+			break
+		}
+	}
+	if around && l.viClass(l.prevChar(end), big) != 0 {
+		for start > 0 && l.viClass(l.prevChar(start), big) == 0 {
+			start = l.prevChar(start)
+		}
+	}
+	return start, end, true
+}
+
+// the quoted string around or after the cursor, pairing quotes from the
+// start of the line
+func (l *LineReader) viQuoteObject(q byte, around bool) (start, end int, ok bool) {
+	b := l.buf.Bytes()
+	open := -1
+	for i := range b {
+		if b[i] != q {
+			continue
+		}
+		if open < 0 {
+			open = i
+			continue
+		}
+		if l.pos <= i {
+			if !around {
+				return open + 1, i, true
+			}
+			end = i + 1
+			for end < len(b) && l.charIs(end, unicode.IsSpace) {
+				end = l.nextChar(end)
+			}
+			return open, end, true
+		}
+		open = -1
+	}
+	return 0, 0, false
+}
+
+// the innermost block delimited by open and close that holds the cursor
+func (l *LineReader) viBlockObject(open, close byte, around bool) (start, end int, ok bool) {
+	b := l.buf.Bytes()
+	if len(b) == 0 {
+		return 0, 0, false
+	}
+	start = l.pos
+	if start >= len(b) {
+		start = len(b) - 1
+	}
+	if b[start] == close {
+		start--
+	}
+	for depth := 0; ; start-- {
+		if start < 0 {
+			return 0, 0, false
+		}
+		if b[start] == close {
+			depth++
+		} else if b[start] == open {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+	}
+	for depth, i := 0, start+1; i < len(b); i++ {
+		if b[i] == open {
+			depth++
+		} else if b[i] == close {
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if around {
+				return start, i + 1, true
+			}
+			return start + 1, i, true
+		}
+	}
+	return 0, 0, false
+}
+
+// the contents of register reg
+func (l *LineReader) viRegister(reg rune) string {
+	return l.vi.registers[unicode.ToLower(reg)]
+}
+
+// put s in register reg and the unnamed register. An upper case register
+// name appends to the lower case register, and _ throws s away.
+func (l *LineReader) viSetRegister(reg rune, s string) {
+	v := &l.vi
+	if reg == '_' {
+		return
+	}
+	if v.registers == nil {
+		v.registers = make(map[rune]string)
+	}
+	if unicode.IsUpper(reg) {
+		reg = unicode.ToLower(reg)
+		s = v.registers[reg] + s
+	}
+	v.registers[reg] = s
+	v.registers['"'] = s
+}
@@ -0,0 +1,186 @@
+package fineline
+
+import (
+	"testing"
+)
+
+// like testEdits, but in vi mode
+func testViEdits(t *testing.T, tests []struct{ input, expected string }) {
+	for _, test := range tests {
+		l, _ := newTestReader(test.input)
+		l.SetEditMode(ViInsertMode)
+		l.getLine()
+		if line, _ := l.Buffer(); line != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, line)
+		}
+	}
+}
+
+func TestViMotions(t *testing.T) {
+	testViEdits(t, []struct{ input, expected string }{
+		{"abc\x1bx", "ab"},
+		{"abc\x1bhhx", "bc"},
+		{"abc\x1b0lx", "ac"},
+		{"abc def\x1b0wx", "abc ef"},
+		{"abc def\x1bbx", "abc ef"},
+		{"abc def\x1b0ex", "ab def"},
+		{"a-b c\x1b0Wx", "a-b "},
+		{"a-b c\x1b0wx", "ab c"},
+		{"  abc\x1b0^x", "  bc"},
+		{"abc\x1b0$x", "ab"},
+		{"abcabc\x1b0fcx;x", "abab"},
+		{"abcabc\x1bFa;x", "bcabc"},
+		{"abcabc\x1b0fb;,x", "acabc"},
+		{"abc\x1b0tcx", "ac"},
+		{"abc\x1b03|x", "ab"},
+	})
+}
+
+func TestViOperators(t *testing.T) {
+	testViEdits(t, []struct{ input, expected string }{
+		{"abc def\x1b0dw", "def"},
+		{"abc def ghi\x1b02dw", "ghi"},
+		{"abc def ghi\x1b0d2w", "ghi"},
+		{"abc def\x1b0cwxyz\x1b", "xyz def"},
+		{"abc def\x1b0dfd", "ef"},
+		{"abc def\x1bdb", "abc f"},
+		{"abc def\x1bdd", ""},
+		{"abc def\x1b0wcc", ""},
+		{"abc def\x1b0wD", "abc "},
+		{"abc def\x1b0wCx", "abc x"},
+		{"abc\x1b0sx", "xbc"},
+		{"abc\x1b0rx", "xbc"},
+		{"abc\x1b03rx", "xxx"},
+		{"abc\x1b04rx", "abc"},
+		{"abc\x1b0~~", "ABc"},
+		{"abc\x1bIx\x1bAy", "xabcy"},
+		{"abc\x1b0ywP", "abcabc"},
+		{"abc\x1b0ywx$p", "bca"},
+		{"abc\x1b0\"ayw\"_dd\"ap", "abc"},
+		{"ab\x1b0\"ayl\"Ayl$\"ap", "abaa"},
+	})
+}
+
+func TestViTextObjects(t *testing.T) {
+	testViEdits(t, []struct{ input, expected string }{
+		{"foo bar baz\x1b0wdiw", "foo  baz"},
+		{"foo bar baz\x1b0wdaw", "foo baz"},
+		{"foo bar\x1bdaw", "foo"},
+		{"foo bar baz\x1b0wd2aw", "foo"},
+		{"say \"hi there\" ok\x1b0fhdi\"", "say \"\" ok"},
+		{"say \"hi there\" ok\x1b0da\"", "say ok"},
+		{"f(a, (b)) c\x1b0fadi(", "f() c"},
+		{"f(a, (b)) c\x1b0fbca(x\x1b", "f(a, x) c"},
+		{"f(a, (b)) c\x1b0f)di)", "f(a, ()) c"},
+		{"x[1] {y}\x1b0f1di]$di{", "x[] {}"},
+		{"abc\x1b0diw", ""},
+		{"abc\x1b0di(", "abc"},
+		{"\x1bci(x\x1b", ""},
+		{"\x1bdib", ""},
+		{"\x1bca{x\x1b", ""},
+	})
+}
+
+func TestViBlockObjectAtEnd(t *testing.T) {
+	l, _ := newTestReader("")
+	for _, test := range []struct {
+		line       string
+		around, ok bool
+		start, end int
+	}{
+		{"f(a)", false, true, 2, 3},
+		{"f(a)", true, true, 1, 4},
+		{"f(a) ", false, false, 0, 0},
+		{"abc", false, false, 0, 0},
+	} {
+		l.buf.reset()
+		l.buf.WriteString(test.line, 0)
+		l.pos = len(test.line)
+		start, end, ok := l.viBlockObject('(', ')', test.around)
+		if ok != test.ok || start != test.start || end != test.end {
+			t.Errorf("%q: expected %d, %d, %v, got %d, %d, %v", test.line, test.start, test.end, test.ok, start, end, ok)
+		}
+	}
+}
+
+func TestViRepeat(t *testing.T) {
+	testViEdits(t, []struct{ input, expected string }{
+		{"abcd\x1b0x..", "d"},
+		{"abcdef\x1b02x.", "ef"},
+		{"abcdef\x1b02x3.", "f"},
+		{"abc def ghi\x1b0dw.", "ghi"},
+		{"abc def\x1b0cwx\x1bw.", "x x"},
+		{"abc\x1b0ix\x1bl.", "xxabc"},
+	})
+}
+
+func TestViUndo(t *testing.T) {
+	testViEdits(t, []struct{ input, expected string }{
+		// everything typed in insert mode is undone at once
+		{"abc\x1bu", ""},
+		{"abc def\x1b0cwxyz\x1bu", "abc def"},
+		{"abc\x1b0xxuu", "abc"},
+		{"abc\x1b0xxuu\x12", "bc"},
+	})
+}
+
+func TestViHistory(t *testing.T) {
+	for _, test := range []struct{ input, expected string }{
+		{"x\x1bk", "two"},
+		{"x\x1bkk", "one"},
+		{"x\x1bkkj", "two"},
+		{"x\x1b2k", "one"},
+		{"x\x1bkjx", ""},
+	} {
+		l, _ := newTestReader(test.input)
+		l.SetMaxHistory(10)
+		l.AddHistory("one")
+		l.AddHistory("two")
+		l.SetEditMode(ViInsertMode)
+		l.getLine()
+		if line, _ := l.Buffer(); line != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, line)
+		}
+	}
+}
+
+func TestViModeChanged(t *testing.T) {
+	l, _ := newTestReader("a\x1bia\x1b\ra\r")
+	var modes []EditMode
+	l.ModeChanged = func(mode EditMode) {
+		modes = append(modes, mode)
+	}
+	l.SetEditMode(ViInsertMode)
+	for _, expected := range []string{"aa\n", "a\n"} {
+		if line, err := l.getLine(); err != nil || line != expected {
+			t.Errorf("expected %q, got %q, %v", expected, line, err)
+		}
+		l.buf.reset()
+		l.pos = 0
+	}
+	expected := []EditMode{ViInsertMode, ViCommandMode, ViInsertMode, ViCommandMode, ViInsertMode}
+	if len(modes) != len(expected) {
+		t.Fatalf("expected modes %v, got %v", expected, modes)
+	}
+	for i := range modes {
+		if modes[i] != expected[i] {
+			t.Errorf("expected modes %v, got %v", expected, modes)
+			break
+		}
+	}
+}
+
+func TestViBind(t *testing.T) {
+	l, _ := newTestReader("bc\x01a\x1b$Qix\r")
+	l.SetEditMode(ViCommandMode)
+	if err := l.Bind("Q", "beginning-of-line"); err != nil {
+		t.Fatal(err)
+	}
+	l.SetEditMode(ViInsertMode)
+	if err := l.Bind("\x01", "beginning-of-line"); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := l.getLine(); line != "xabc\n" {
+		t.Errorf("expected %q, got %q", "xabc\n", line)
+	}
+}
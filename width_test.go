@@ -0,0 +1,94 @@
+package fineline
+
+import (
+	"testing"
+)
+
+var widthTests = []struct {
+	s     string
+	width int
+}{
+	{"", 0},
+	{"hello", 5},
+	{"héllo", 5},
+	{"he\u0301llo", 5},
+	{"日本語", 6},
+	{"ｈｉ", 4},
+	{"한국어", 6},
+	{"가", 2},
+	{"😀", 2},
+	{"a\u200db", 2},
+	{"\x01", 2},
+}
+
+func TestStringWidth(t *testing.T) {
+	for _, test := range widthTests {
+		if w := stringWidth(test.s); w != test.width {
+			t.Errorf("%q: expected width %d, got %d", test.s, test.width, w)
+		}
+	}
+}
+
+var cursorTests = []struct {
+	input string
+	line  string
+	x, y  int
+}{
+	{"héllo\x02\x02", "héllo", 5, 0},
+	{"héllo\x08\x08\x08\x08x", "hx", 4, 0},
+	{"日本語\x02\x08", "日語", 4, 0},
+	{"日本語\x01\x04", "本語", 2, 0},
+	{"ab日本\x14", "ab本日", 8, 0},
+	{"日本語\x02\x02\x14", "本日語", 4, 0},
+	// the fourth wide character doesn't fit on the first row
+	{"日本語日", "日本語日", 2, 1},
+	{"日本語日\x02", "日本語日", 0, 1},
+	{"abcdefg", "abcdefg", 0, 1},
+	{"abcdefgh", "abcdefgh", 1, 1},
+	{"abcdefg\x01", "abcdefg", 2, 0},
+}
+
+func TestCursor(t *testing.T) {
+	for _, test := range cursorTests {
+		l, _ := newTestReader(test.input)
+		l.cols = 9
+		l.getLine()
+		line, _ := l.Buffer()
+		if line != test.line || l.x != test.x || l.y != test.y {
+			t.Errorf("%q: expected %q at %d,%d, got %q at %d,%d", test.input,
+				test.line, test.x, test.y, line, l.x, l.y)
+		}
+	}
+}
+
+func TestGraphemeWidth(t *testing.T) {
+	for _, test := range []struct {
+		s     string
+		width int
+	}{
+		{"\U0001f468\u200d\U0001f469\u200d\U0001f467", 2},
+		{"\U0001f1fa\U0001f1f8", 2},
+		{"❤\ufe0f", 2},
+		{"❤", 1},
+		{"e\u0301", 1},
+		{"각", 2},
+	} {
+		if w := stringWidth(test.s); w != test.width {
+			t.Errorf("%+q: expected width %d, got %d", test.s, test.width, w)
+		}
+	}
+}
+
+func TestStripEscapes(t *testing.T) {
+	for _, test := range []struct{ in, expected string }{
+		{"abc", "abc"},
+		{"\x1b[1;31mred\x1b[0m", "red"},
+		{"\x1b]8;;http://example.com\x1b\\link\x1b]8;;\a", "link"},
+		{"a\x1bMb", "ab"},
+		{"a\x1b[", "a"},
+	} {
+		if s := stripEscapes(test.in); s != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.in, test.expected, s)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package fineline
 import (
 	"fmt"
 	"os"
-	"strings"
 	"syscall"
 	"unsafe"
 )
@@ -13,7 +12,6 @@ type LineReader struct {
 
 	// console handle
 	h uintptr
-	rows int
 	origTerm uint32
 }
 
@@ -71,7 +69,7 @@ type consoleScreenBufferInfo struct {
 }
 
 // enable raw mode and gather metrics, like number of columns
-func (l *LineReader) raw() {
+func (l *LineReader) raw() error {
 	// STD_OUTPUT_HANDLE
 	h, errno := syscall.GetStdHandle(-11)
 	t.h = uintptr(h)
@@ -99,6 +97,7 @@ func (l *LineReader) raw() {
 	t.rows = int(win.dwSize.y)
 
 	t.buf = new(buffer)
+	return nil
 }
 
 func (l *LineReader) restore() {
@@ -123,12 +122,6 @@ func (l *LineReader) eraseToEnd() {
 	t.fillConsoleOutputCharacter(' ' << 8, length, pos)
 }
 
-func (l *LineReader) printCandidates() {
-	str := "\n\x1b[0G" + strings.Join(t.candidates, "\n\x1b[0G") + "\n"
-	fmt.Print(str)
-	t.refreshLine()
-}
-
 func (l *LineReader) clearScreen() {
 	pos := coord{}
 	t.fillConsoleOutputCharacter(' ' << 8, t.cols*t.rows, pos)
@@ -0,0 +1,122 @@
+package fineline
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// reports whether r is part of a word, using IsWordChar if it's set
+func (l *lineReader) isWordChar(r rune) bool {
+	if l.IsWordChar != nil {
+		return l.IsWordChar(r)
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// calls f with the first rune of the character at pos
+func (l *lineReader) charIs(pos int, f func(rune) bool) bool {
+	r, _ := utf8.DecodeRune(l.buf.Bytes()[pos:])
+	return f(r)
+}
+
+// returns the end of the word at or after pos
+func (l *lineReader) wordEnd(pos int) int {
+	n := l.buf.len()
+	for pos < n && !l.charIs(pos, l.isWordChar) {
+		pos = l.nextChar(pos)
+	}
+	for pos < n && l.charIs(pos, l.isWordChar) {
+		pos = l.nextChar(pos)
+	}
+	return pos
+}
+
+// returns the start of the word before pos
+func (l *lineReader) wordStart(pos int) int {
+	for pos > 0 && !l.charIs(l.prevChar(pos), l.isWordChar) {
+		pos = l.prevChar(pos)
+	}
+	for pos > 0 && l.charIs(l.prevChar(pos), l.isWordChar) {
+		pos = l.prevChar(pos)
+	}
+	return pos
+}
+
+func (l *LineReader) forwardWord() {
+	if l.acceptHint(true) {
+		return
+	}
+	l.pos = l.wordEnd(l.pos)
+	l.refreshLine()
+}
+
+func (l *LineReader) backwardWord() {
+	l.pos = l.wordStart(l.pos)
+	l.refreshLine()
+}
+
+func (l *LineReader) killWord() {
+	l.kill(l.pos, l.wordEnd(l.pos))
+}
+
+func (l *LineReader) backwardKillWord() {
+	l.kill(l.wordStart(l.pos), l.pos)
+}
+
+// kill back to the previous whitespace, whatever IsWordChar says
+func (l *LineReader) unixWordRubout() {
+	start := l.pos
+	for start > 0 && l.charIs(l.prevChar(start), unicode.IsSpace) {
+		start = l.prevChar(start)
+	}
+	for start > 0 && !l.charIs(l.prevChar(start), unicode.IsSpace) {
+		start = l.prevChar(start)
+	}
+	l.kill(start, l.pos)
+}
+
+// swap the words before and after the cursor, or the last two if there's no
+// word after it, and leave the cursor after them
+func (l *LineReader) transposeWords() {
+	end2 := l.wordEnd(l.pos)
+	start2 := l.wordStart(end2)
+	start1 := l.wordStart(start2)
+	end1 := l.wordEnd(start1)
+	if start1 == start2 || end1 > start2 {
+		return
+	}
+	b := l.buf.Bytes()
+	s := string(b[start2:end2]) + string(b[end1:start2]) + string(b[start1:end1])
+	l.replace(start1, end2, s)
+}
+
+// change the case of the rest of the word at the cursor with f
+func (l *LineReader) caseWord(f func(string) string) {
+	end := l.wordEnd(l.pos)
+	if end == l.pos {
+		return
+	}
+	l.replace(l.pos, end, f(string(l.buf.Bytes()[l.pos:end])))
+}
+
+func (l *LineReader) capitalizeWord() {
+	l.caseWord(func(s string) string {
+		i := strings.IndexFunc(s, l.isWordChar)
+		if i < 0 {
+			// there's no word, just what separates them
+			return s
+		}
+		_, n := utf8.DecodeRuneInString(s[i:])
+		return s[:i] + strings.ToUpper(s[i:i+n]) + strings.ToLower(s[i+n:])
+	})
+}
+
+// replace the text from start to end with s and put the cursor after it
+func (l *LineReader) replace(start, end int, s string) {
+	l.saveUndo()
+	l.buf.remove(start, end)
+	l.buf.WriteString(s, start)
+	l.pos = start + len(s)
+	l.refreshLine()
+}